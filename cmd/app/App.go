@@ -2,13 +2,19 @@ package app
 
 import (
 	"context"
+	"log"
+	"net"
 	"socketChat/configs"
+	"socketChat/internal/enums"
 	"socketChat/internal/handlers"
+	"socketChat/internal/interfaces"
+	"socketChat/internal/models"
 	"socketChat/internal/repositories"
 	"socketChat/internal/servers/database"
 	"socketChat/internal/servers/http"
 	"socketChat/internal/services"
 	"sync"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -19,9 +25,14 @@ var (
 )
 
 type App struct {
-	redis   *redis.Client
-	ctx     context.Context
-	configs *configs.Config
+	redis       *redis.Client
+	broker      interfaces.Broker
+	fileManager interfaces.FileManager
+	fileScanner interfaces.FileScanner
+	// Only set when files are stored on the local disk
+	localFileHandler *handlers.LocalFileHandler
+	ctx              context.Context
+	configs          *configs.Config
 }
 
 func GetApp() *App {
@@ -33,31 +44,69 @@ func GetApp() *App {
 
 func (app *App) LetsGo() {
 	app.ctx = context.Background()
-	app.initializeRedis()
 	app.initializeConfigs()
+	app.initializeBroker()
+	app.initializeFileManager()
+	app.initializeFileScanner()
 
 	db := database.GetDB(app.configs)
 	authRepo := repositories.NewAuthenticationRepository(db)
 	authService := services.NewAuthenticationService(authRepo, app.configs)
+	fileManagerService := services.NewFileManagerService(app.fileManager)
+	storageRepo := repositories.NewStorageRepository(db)
+	storageService := services.NewStorageService(storageRepo, fileManagerService, app.configs)
 	chatRepo := repositories.NewChatRepository(db)
-	chatService := services.NewChatService(chatRepo)
+	chatService := services.NewChatService(chatRepo, storageService, app.configs)
 	whiteboardRepo := repositories.NewWhiteboardRepository(db)
 	whiteboardService := services.NewWhiteboardService(whiteboardRepo)
 
-	minioService := services.NewMinioService(app.configs)
-	fileManagerService := services.NewFileManagerService(minioService)
+	socketClientOptions := app.socketClientOptions()
+	socketChatHandler := handlers.NewSocketChatHandler(app.broker, app.ctx, chatService, socketClientOptions, app.configs)
+
+	attachmentRepo := repositories.NewAttachmentRepository(db)
+	fileValidatorService := services.NewFileValidatorService(app.configs)
+	thumbnailService := services.NewThumbnailService(app.ctx, attachmentRepo, fileManagerService, app.configs)
+	attachmentScanService := services.NewAttachmentScanService(
+		app.ctx,
+		attachmentRepo,
+		chatRepo,
+		fileManagerService,
+		app.fileScanner,
+		func(scanned *models.AttachmentScanned) {
+			if err := socketChatHandler.PublishEvent(enums.SOCKET_EVENT_ATTACHMENT_SCANNED, scanned.ConversationID, scanned); err != nil {
+				log.Printf("App / LetsGo / Error publishing scan of attachment %v: %v", scanned.Attachment.ID, err)
+			}
+		},
+		app.configs,
+	)
+	attachmentService := services.NewAttachmentService(attachmentRepo, chatRepo, fileManagerService, fileValidatorService, thumbnailService, attachmentScanService, storageService, app.configs)
+
+	uploadRepo := repositories.NewUploadRepository(db)
+	uploadService := services.NewUploadService(app.ctx, uploadRepo, fileManagerService, attachmentService, storageService, app.configs)
+	services.NewGarbageCollectorService(app.ctx, authRepo, attachmentRepo, uploadRepo, storageRepo, fileManagerService, storageService, app.configs)
 
 	restHandler := handlers.NewRestandler(
 		authService,
 		chatService,
 		whiteboardService,
 		fileManagerService,
+		attachmentService,
+		thumbnailService,
+		uploadService,
+		fileValidatorService,
+		storageService,
+		socketChatHandler,
 	)
-
-	socketChatHandler := handlers.NewSocketChatHandler(app.redis, app.ctx, chatService)
 	htmlHandler := handlers.NewHtmlHandler(authService, chatService, fileManagerService)
-	socketObservingHandler := handlers.NewSocketUserObservingHandler(app.redis, app.ctx, authService)
-	socketWhiteboardHandler := handlers.NewSocketWhiteboardHandler(app.redis, app.ctx, whiteboardService)
+	socketObservingHandler := handlers.NewSocketUserObservingHandler(app.redis, app.broker, app.ctx, authService, socketClientOptions)
+	socketWhiteboardHandler := handlers.NewSocketWhiteboardHandler(app.broker, app.ctx, whiteboardService, socketClientOptions)
+	socketRouterHandler := handlers.NewSocketRouterHandler(
+		app.ctx,
+		socketChatHandler,
+		socketObservingHandler,
+		socketWhiteboardHandler,
+		socketClientOptions,
+	)
 
 	http.NewHttpServer(
 		app.ctx,
@@ -66,16 +115,64 @@ func (app *App) LetsGo() {
 		socketChatHandler,
 		socketObservingHandler,
 		socketWhiteboardHandler,
+		socketRouterHandler,
 		htmlHandler,
+		app.localFileHandler,
 	).Run()
 }
 
 func (app *App) initializeRedis() {
 	app.redis = redis.NewClient(&redis.Options{
-		Addr: "socket-chat-redis:6379",
+		Addr:     net.JoinHostPort(app.configs.Viper.GetString("redis.host"), app.configs.Viper.GetString("redis.port")),
+		Password: app.configs.Viper.GetString("redis.password"),
 	})
 }
 
+// The in-memory broker only fans events out inside this process and needs no Redis at all
+func (app *App) initializeBroker() {
+	maxLen := app.configs.Viper.GetInt64("broker.max_len")
+	channelTTL := time.Duration(app.configs.Viper.GetInt("broker.channel_ttl")) * time.Second
+	switch app.configs.Viper.GetString("broker.type") {
+	case enums.BROKER_TYPE_MEMORY:
+		app.broker = services.NewMemoryBrokerService(maxLen, channelTTL)
+	default:
+		app.initializeRedis()
+		app.broker = services.NewRedisBrokerService(app.ctx, app.redis, maxLen, channelTTL)
+	}
+}
+
+// Local files need no MinIO, they are served by the application itself through signed URLs
+func (app *App) initializeFileManager() {
+	switch app.configs.Viper.GetString("files.type") {
+	case enums.FILE_MANAGER_TYPE_LOCAL:
+		localFileManager := services.NewLocalFileManagerService(app.configs)
+		app.fileManager = localFileManager
+		app.localFileHandler = handlers.NewLocalFileHandler(localFileManager, app.configs)
+	default:
+		app.fileManager = services.NewMinioService(app.configs)
+	}
+}
+
+// Without a scanner the scan workers mark every attachment clean
+func (app *App) initializeFileScanner() {
+	switch app.configs.Viper.GetString("scanner.type") {
+	case enums.FILE_SCANNER_TYPE_CLAMAV:
+		app.fileScanner = services.NewClamAVScannerService(app.configs)
+	default:
+		app.fileScanner = services.NewNoopScannerService()
+	}
+}
+
 func (app *App) initializeConfigs() {
 	app.configs = configs.GetConfig()
 }
+
+func (app *App) socketClientOptions() *models.SocketClientOptions {
+	return &models.SocketClientOptions{
+		SendQueueSize:    app.configs.Viper.GetInt("socket.send_queue_size"),
+		SlowClientPolicy: app.configs.Viper.GetString("socket.slow_client_policy"),
+		WriteTimeout:     time.Duration(app.configs.Viper.GetInt("socket.write_timeout")) * time.Second,
+		PingInterval:     time.Duration(app.configs.Viper.GetInt("socket.ping_interval")) * time.Second,
+		PongTimeout:      time.Duration(app.configs.Viper.GetInt("socket.pong_timeout")) * time.Second,
+	}
+}
@@ -0,0 +1,10 @@
+package enums
+
+const (
+	// Not scanned yet, only the uploader can read the file
+	ATTACHMENT_SCAN_STATUS_PENDING     = "pending"
+	ATTACHMENT_SCAN_STATUS_CLEAN       = "clean"
+	ATTACHMENT_SCAN_STATUS_QUARANTINED = "quarantined"
+	// Too large for the scanner or refused by it too many times, only the uploader can read the file
+	ATTACHMENT_SCAN_STATUS_FAILED = "failed"
+)
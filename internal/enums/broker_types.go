@@ -0,0 +1,6 @@
+package enums
+
+const (
+	BROKER_TYPE_REDIS  = "redis"
+	BROKER_TYPE_MEMORY = "memory"
+)
@@ -1,5 +1,11 @@
 package enums
 
 const (
-	FILE_BUCKET_USER_PROFILE = "user-profile-photos"
-)
\ No newline at end of file
+	FILE_BUCKET_USER_PROFILE        = "user-profile-photos"
+	FILE_BUCKET_MESSAGE_ATTACHMENTS = "message-attachments"
+	// Chunks of resumable uploads until they are assembled
+	FILE_BUCKET_UPLOAD_CHUNKS = "upload-chunks"
+)
+
+// Buckets file managers create on start
+var FILE_BUCKETS = []string{FILE_BUCKET_USER_PROFILE, FILE_BUCKET_MESSAGE_ATTACHMENTS, FILE_BUCKET_UPLOAD_CHUNKS}
@@ -0,0 +1,6 @@
+package enums
+
+const (
+	FILE_MANAGER_TYPE_MINIO = "minio"
+	FILE_MANAGER_TYPE_LOCAL = "local"
+)
@@ -0,0 +1,7 @@
+package enums
+
+const (
+	// Files are considered clean without being scanned
+	FILE_SCANNER_TYPE_NONE   = "none"
+	FILE_SCANNER_TYPE_CLAMAV = "clamav"
+)
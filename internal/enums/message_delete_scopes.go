@@ -0,0 +1,6 @@
+package enums
+
+const (
+	MESSAGE_DELETE_SCOPE_ME       = "me"
+	MESSAGE_DELETE_SCOPE_EVERYONE = "everyone"
+)
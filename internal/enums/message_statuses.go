@@ -0,0 +1,7 @@
+package enums
+
+const (
+	MESSAGE_STATUS_SENT      = "sent"
+	MESSAGE_STATUS_DELIVERED = "delivered"
+	MESSAGE_STATUS_READ      = "read"
+)
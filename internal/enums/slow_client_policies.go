@@ -0,0 +1,6 @@
+package enums
+
+const (
+	SLOW_CLIENT_POLICY_DROP_OLDEST = "drop_oldest"
+	SLOW_CLIENT_POLICY_DISCONNECT  = "disconnect"
+)
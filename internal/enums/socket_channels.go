@@ -0,0 +1,7 @@
+package enums
+
+const (
+	SOCKET_CHANNEL_CHAT       = "chat"
+	SOCKET_CHANNEL_OBSERVE    = "observe"
+	SOCKET_CHANNEL_WHITEBOARD = "whiteboard"
+)
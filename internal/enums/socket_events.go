@@ -1,9 +1,23 @@
 package enums
 
 const (
-	SOCKET_EVENT_SEND_MESSAGE      = "send_message"
-	SOCKET_EVENT_SEEN_MESSAGE      = "seen_message"
-	SOCKET_EVENT_IS_TYPING         = "is_typing"
-	SOCKET_EVENT_NOTIFY            = "notify"
-	SOCKET_EVENT_UPDATE_WHITEBOARD = "update_whiteboard"
+	SOCKET_EVENT_SEND_MESSAGE       = "send_message"
+	SOCKET_EVENT_SEEN_MESSAGE       = "seen_message"
+	SOCKET_EVENT_IS_TYPING          = "is_typing"
+	SOCKET_EVENT_NOTIFY             = "notify"
+	SOCKET_EVENT_UPDATE_WHITEBOARD  = "update_whiteboard"
+	SOCKET_EVENT_SUBSCRIBE          = "subscribe"
+	SOCKET_EVENT_UNSUBSCRIBE        = "unsubscribe"
+	SOCKET_EVENT_EDIT_MESSAGE       = "edit_message"
+	SOCKET_EVENT_MESSAGE_EDITED     = "message_edited"
+	SOCKET_EVENT_DELETE_MESSAGE     = "delete_message"
+	SOCKET_EVENT_MESSAGE_DELETED    = "message_deleted"
+	SOCKET_EVENT_ADD_REACTION       = "add_reaction"
+	SOCKET_EVENT_REMOVE_REACTION    = "remove_reaction"
+	SOCKET_EVENT_MARK_READ_UP_TO    = "mark_read_up_to"
+	SOCKET_EVENT_MESSAGE_DELIVERED  = "message_delivered"
+	SOCKET_EVENT_ACK                = "ack"
+	SOCKET_EVENT_ERROR              = "error"
+	SOCKET_EVENT_ATTACHMENT_SCANNED = "attachment_scanned"
+	SOCKET_EVENT_REPLAY_TRUNCATED   = "replay_truncated"
 )
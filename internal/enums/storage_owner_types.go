@@ -0,0 +1,6 @@
+package enums
+
+const (
+	STORAGE_OWNER_TYPE_USER         = "user"
+	STORAGE_OWNER_TYPE_CONVERSATION = "conversation"
+)
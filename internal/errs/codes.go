@@ -0,0 +1,108 @@
+package errs
+
+import "errors"
+
+// ErrCodeInternal is the code of errors that don't come from this package
+const ErrCodeInternal = "INTERNAL_ERROR"
+
+// codes holds the machine-readable code of every error of this package.
+// Codes are part of the client contract, they must stay the same when messages are reworded.
+var codes = map[Error]string{
+	ErrInvalidPassword:            "INVALID_PASSWORD",
+	ErrPasswordAtLeast8Characters: "PASSWORD_MUST_BE_AT_LEAST_8_CHARACTERS_LONG",
+	ErrPasswordAtLeastOneDigit:    "PASSWORD_MUST_CONTAIN_AT_LEAST_ONE_DIGIT",
+	ErrPasswordAtLeastOneSpecial:  "PASSWORD_MUST_CONTAIN_AT_LEAST_ONE_SPECIAL_CHARACTER",
+	ErrPasswordAtLeastOneLower:    "PASSWORD_MUST_CONTAIN_AT_LEAST_ONE_LOWERCASE_LETTER",
+	ErrPasswordAtLeastOneUpper:    "PASSWORD_MUST_CONTAIN_AT_LEAST_ONE_UPPERCASE_LETTER",
+
+	ErrUnauthorized: "UNAUTHORIZED",
+
+	ErrConversationCreationFailed: "CONVERSATION_CREATION_FAILED",
+	ErrInvalidConversationId:      "INVALID_CONVERSATION_ID",
+
+	ErrNoFileUploaded:             "NO_FILE_UPLOADED",
+	ErrUnableToOpenUploadedFile:   "UNABLE_TO_OPEN_UPLOADED_FILE",
+	ErrUnableToUploadFile:         "UNABLE_TO_UPLOAD_FILE",
+	ErrUnableToUpdateProfilePhoto: "UNABLE_TO_UPDATE_PROFILE_PHOTO",
+	ErrInvalidAttachment:          "ATTACHMENT_NOT_FOUND_OR_ALREADY_SENT",
+	ErrInvalidImage:               "FILE_IS_NOT_A_SUPPORTED_IMAGE",
+	ErrImageTooLarge:              "IMAGE_DIMENSIONS_ARE_TOO_LARGE",
+	ErrFileNotFound:               "FILE_NOT_FOUND",
+	ErrAttachmentNotFound:         "ATTACHMENT_NOT_FOUND",
+	ErrInvalidObjectKey:           "INVALID_OBJECT_KEY",
+	ErrInvalidSignature:           "INVALID_SIGNATURE",
+	ErrSignedUrlExpired:           "SIGNED_URL_EXPIRED",
+	ErrUploadNotFound:             "UPLOAD_NOT_FOUND",
+	ErrInvalidUploadSize:          "INVALID_UPLOAD_SIZE",
+	ErrUploadOffsetMismatch:       "UPLOAD_OFFSET_DOES_NOT_MATCH",
+	ErrChunkTooLarge:              "CHUNK_IS_TOO_LARGE",
+	ErrUploadIncomplete:           "UPLOAD_IS_NOT_COMPLETE",
+	ErrFileTooLarge:               "FILE_IS_TOO_LARGE",
+	ErrFileTypeNotAllowed:         "FILE_TYPE_IS_NOT_ALLOWED",
+	ErrMalformedFile:              "FILE_IS_MALFORMED",
+	ErrPolyglotFile:               "FILE_CONTENT_MATCHES_MORE_THAN_ONE_FORMAT",
+	ErrAttachmentNotScanned:       "ATTACHMENT_IS_NOT_SCANNED_YET",
+	ErrAttachmentQuarantined:      "ATTACHMENT_IS_QUARANTINED",
+	ErrFileScanFailed:             "FILE_SCAN_FAILED",
+	ErrStorageQuotaExceeded:       "STORAGE_QUOTA_EXCEEDED",
+	ErrConversationQuotaExceeded:  "STORAGE_QUOTA_OF_THE_CONVERSATION_EXCEEDED",
+
+	ErrMessageNotFound:     "MESSAGE_NOT_FOUND",
+	ErrNotMessageSender:    "ONLY_THE_SENDER_CAN_MODIFY_THE_MESSAGE",
+	ErrEmptyMessageContent: "MESSAGE_CONTENT_IS_EMPTY",
+	ErrInvalidDeleteScope:  "INVALID_DELETE_SCOPE",
+	ErrDeleteWindowExpired: "MESSAGE_CAN_NO_LONGER_BE_DELETED_FOR_EVERYONE",
+	ErrInvalidReplyTo:      "REPLIED_MESSAGE_IS_NOT_IN_THIS_CONVERSATION",
+	ErrInvalidEmoji:        "INVALID_EMOJI",
+	ErrInvalidThreadRoot:   "THREAD_ROOT_IS_NOT_A_TOP_LEVEL_MESSAGE_OF_THIS_CONVERSATION",
+	ErrInvalidReadPosition: "READ_POSITION_IS_NOT_A_TOP_LEVEL_MESSAGE_OF_THIS_CONVERSATION",
+	ErrInvalidClientId:     "CLIENT_ID_MUST_BE_A_UUID",
+
+	ErrConversationNotFound: "CONVERSATION_NOT_FOUND",
+	NoneOfMessagesSeen:      "NONE_OF_MESSAGES_SEEN",
+
+	ErrInvalidwhiteboardId:                  "WHITEBOARD_NOT_FOUND",
+	ErrWhiteboardCreationFailed:             "WHITEBOARD_CREATION_FAILED",
+	ErrNoWhiteboardFoundForThisConversation: "NO_WHITEBOARD_FOUND_FOR_THIS_CONVERSATION",
+
+	ErrObservingSocketOperationRequired: "OBSERVING_SOCKET_OPERATION_REQUIRED",
+	ErrInvalidObservingSocketOperation:  "INVALID_OBSERVING_SOCKET_OPERATION",
+	ErrObservingSocketStatusRequired:    "OBSERVING_SOCKET_STATUS_REQUIRED",
+
+	ErrUnknownSocketChannel: "UNKNOWN_SOCKET_CHANNEL",
+	ErrUnknownSocketEvent:   "UNKNOWN_SOCKET_EVENT",
+	ErrNotSubscribed:        "NOT_SUBSCRIBED_TO_CHANNEL",
+	ErrSubscriptionFailed:   "COULD_NOT_SUBSCRIBE_TO_CHANNEL",
+	ErrInvalidBrokerMessage: "INVALID_BROKER_MESSAGE",
+	ErrCacheNotConfigured:   "CACHE_NOT_CONFIGURED",
+
+	ErrInvalidRequestBody: "INVALID_REQUEST_BODY",
+	ErrUserAlreadyExists:  "USER_ALREADY_EXISTS",
+	ErrUserNotFound:       "USER_NOT_FOUND",
+	ErrThereIsNoUser:      "THERE_IS_NO_USER",
+	ErrUserIsNil:          "USER_IS_NIL",
+	ErrWrongPassword:      "WRONG_PASSWORD",
+	ErrWrongEmail:         "WRONG_EMAIL",
+	ErrWrongToken:         "WRONG_TOKEN",
+	ErrInvalidToken:       "INVALID_TOKEN",
+	ErrInvalidEmail:       "INVALID_EMAIL",
+	ErrInvalidUser:        "INVALID_USER",
+	ErrInvalidRequest:     "INVALID_REQUEST",
+	ErrInvalidParams:      "INVALID_PARAMS",
+	ErrInvalidPageOrSize:  "INVALID_PAGE_OR_SIZE",
+	ErrFirstName:          "FIRST_NAME_IS_EMPTY_OR_TOO_SHORT",
+	ErrLastName:           "LAST_NAME_IS_EMPTY_OR_TOO_SHORT",
+}
+
+// Code returns the machine-readable code of an error, e.g. MESSAGE_NOT_FOUND for ErrMessageNotFound.
+// Errors without a code are internal errors.
+func Code(err error) string {
+	var e Error
+	if !errors.As(err, &e) {
+		return ErrCodeInternal
+	}
+	if code, ok := codes[e]; ok {
+		return code
+	}
+	return ErrCodeInternal
+}
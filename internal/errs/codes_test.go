@@ -0,0 +1,81 @@
+package errs
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"package error", ErrMessageNotFound, "MESSAGE_NOT_FOUND"},
+		{"code independent of the message", ErrInvalidAttachment, "ATTACHMENT_NOT_FOUND_OR_ALREADY_SENT"},
+		{"wrapped package error", fmt.Errorf("saving message: %w", ErrInvalidClientId), "CLIENT_ID_MUST_BE_A_UUID"},
+		{"error without a code", Error("reworded message"), ErrCodeInternal},
+		{"foreign error", fmt.Errorf("connection refused"), ErrCodeInternal},
+		{"nil", nil, ErrCodeInternal},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Code(test.err); got != test.want {
+				t.Errorf("Code(%v) = %q, want %q", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+// Every error declared in errors.go must have a code of its own
+func TestEveryErrorHasUniqueCode(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "errors.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var declared int
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			for _, name := range spec.(*ast.ValueSpec).Names {
+				declared++
+				if _, ok := codes[Error(constantValue(t, file, name.Name))]; !ok {
+					t.Errorf("%v has no code", name.Name)
+				}
+			}
+		}
+	}
+	if declared != len(codes) {
+		t.Errorf("%v errors declared, %v codes", declared, len(codes))
+	}
+
+	owners := make(map[string]Error)
+	for err, code := range codes {
+		if owner, ok := owners[code]; ok {
+			t.Errorf("code %v is used by both %q and %q", code, owner, err)
+		}
+		owners[code] = err
+	}
+}
+
+// constantValue returns the message of the error constant with the given name
+func constantValue(t *testing.T, file *ast.File, name string) string {
+	t.Helper()
+	spec := file.Scope.Lookup(name).Decl.(*ast.ValueSpec)
+	for i, ident := range spec.Names {
+		if ident.Name != name {
+			continue
+		}
+		call := spec.Values[i].(*ast.CallExpr)
+		literal := call.Args[0].(*ast.BasicLit)
+		return literal.Value[1 : len(literal.Value)-1]
+	}
+	t.Fatalf("%v not found", name)
+	return ""
+}
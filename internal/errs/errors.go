@@ -21,8 +21,39 @@ const (
 	ErrUnableToOpenUploadedFile = Error("unable to open uploaded file")
 	ErrUnableToUploadFile       = Error("unable to upload file")
 	ErrUnableToUpdateProfilePhoto = Error("unable to update profile photo")
+	ErrInvalidAttachment          = Error("attachment not found or already sent")
+	ErrInvalidImage               = Error("file is not a supported image")
+	ErrImageTooLarge              = Error("image dimensions are too large")
+	ErrFileNotFound               = Error("file not found")
+	ErrAttachmentNotFound         = Error("attachment not found")
+	ErrInvalidObjectKey           = Error("invalid object key")
+	ErrInvalidSignature           = Error("invalid signature")
+	ErrSignedUrlExpired           = Error("signed url expired")
+	ErrUploadNotFound             = Error("upload not found")
+	ErrInvalidUploadSize          = Error("invalid upload size")
+	ErrUploadOffsetMismatch       = Error("upload offset does not match")
+	ErrChunkTooLarge              = Error("chunk is too large")
+	ErrUploadIncomplete           = Error("upload is not complete")
+	ErrFileTooLarge               = Error("file is too large")
+	ErrFileTypeNotAllowed         = Error("file type is not allowed")
+	ErrMalformedFile              = Error("file is malformed")
+	ErrPolyglotFile               = Error("file content matches more than one format")
+	ErrAttachmentNotScanned       = Error("attachment is not scanned yet")
+	ErrAttachmentQuarantined      = Error("attachment is quarantined")
+	ErrFileScanFailed             = Error("file scan failed")
+	ErrStorageQuotaExceeded       = Error("storage quota exceeded")
+	ErrConversationQuotaExceeded  = Error("storage quota of the conversation exceeded")
 
-	ErrMessageNotFound = Error("message not found")
+	ErrMessageNotFound     = Error("message not found")
+	ErrNotMessageSender    = Error("only the sender can modify the message")
+	ErrEmptyMessageContent = Error("message content is empty")
+	ErrInvalidDeleteScope  = Error("invalid delete scope")
+	ErrDeleteWindowExpired = Error("message can no longer be deleted for everyone")
+	ErrInvalidReplyTo      = Error("replied message is not in this conversation")
+	ErrInvalidEmoji        = Error("invalid emoji")
+	ErrInvalidThreadRoot   = Error("thread root is not a top level message of this conversation")
+	ErrInvalidReadPosition = Error("read position is not a top level message of this conversation")
+	ErrInvalidClientId     = Error("client id must be a uuid")
 
 	ErrConversationNotFound = Error("conversation not found")
 	NoneOfMessagesSeen      = Error("none of messages seen")
@@ -36,6 +67,13 @@ const (
 	ErrInvalidObservingSocketOperation = Error("invalid observing socket operation")
 	ErrObservingSocketStatusRequired = Error("observing socket status required")
 
+	ErrUnknownSocketChannel = Error("unknown socket channel")
+	ErrUnknownSocketEvent   = Error("unknown socket event")
+	ErrNotSubscribed        = Error("not subscribed to channel")
+	ErrSubscriptionFailed   = Error("could not subscribe to channel")
+	ErrInvalidBrokerMessage = Error("invalid broker message")
+	ErrCacheNotConfigured   = Error("cache not configured")
+
 	ErrInvalidRequestBody = Error("invalid request body")
 	ErrUserAlreadyExists  = Error("user already exists")
 	ErrUserNotFound       = Error("user not found")
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+	"socketChat/configs"
+	"socketChat/internal/enums"
+	"socketChat/internal/errs"
+	"socketChat/internal/models"
+	"socketChat/internal/msgs"
+	"socketChat/internal/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LocalFileHandler serves the signed download and upload URLs of the local file manager
+type LocalFileHandler struct {
+	localFileManager *services.LocalFileManagerService
+	// [bucket] => largest body accepted by signed uploads
+	maxUploadSizes map[string]int64
+}
+
+func NewLocalFileHandler(localFileManager *services.LocalFileManagerService, config *configs.Config) *LocalFileHandler {
+	// Buckets without validation rules, like the one of upload chunks, take the limit of uploads
+	maxUploadSizes := make(map[string]int64)
+	for _, bucketName := range enums.FILE_BUCKETS {
+		maxSize := config.Viper.GetInt64("validation." + bucketName + ".max_size")
+		if maxSize <= 0 {
+			maxSize = config.Viper.GetInt64("uploads.max_size")
+		}
+		maxUploadSizes[bucketName] = maxSize
+	}
+	return &LocalFileHandler{
+		localFileManager: localFileManager,
+		maxUploadSizes:   maxUploadSizes,
+	}
+}
+
+func (lfh *LocalFileHandler) Download(ctx *gin.Context) {
+	bucketName, fileName, ok := lfh.verify(ctx)
+	if !ok {
+		return
+	}
+	lfh.serve(ctx, bucketName, fileName)
+}
+
+// DownloadPublic serves the files of a public bucket at the path UploadFile returned for them, without a signature
+func (lfh *LocalFileHandler) DownloadPublic(bucketName string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		lfh.serve(ctx, bucketName, strings.TrimPrefix(ctx.Param("key"), "/"))
+	}
+}
+
+func (lfh *LocalFileHandler) serve(ctx *gin.Context, bucketName string, fileName string) {
+	file, info, err := lfh.localFileManager.Download(bucketName, fileName)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == errs.ErrFileNotFound || err == errs.ErrInvalidObjectKey {
+			status = http.StatusNotFound
+		}
+		ctx.AbortWithStatusJSON(status, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{err},
+		})
+		return
+	}
+	defer file.Close()
+
+	// Browsers render images inline, anything else is downloaded rather than rendered on the origin of the application
+	extraHeaders := map[string]string{"X-Content-Type-Options": "nosniff"}
+	if !isInlineContentType(info.ContentType) {
+		extraHeaders["Content-Disposition"] = mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(fileName)})
+	}
+	ctx.Header("Cache-Control", "private")
+	ctx.Header("ETag", info.ETag)
+	ctx.DataFromReader(http.StatusOK, info.Size, info.ContentType, file, extraHeaders)
+}
+
+func (lfh *LocalFileHandler) Upload(ctx *gin.Context) {
+	bucketName, fileName, ok := lfh.verify(ctx)
+	if !ok {
+		return
+	}
+
+	maxSize := lfh.maxUploadSizes[bucketName]
+	if ctx.Request.ContentLength < 0 {
+		ctx.AbortWithStatusJSON(http.StatusLengthRequired, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrInvalidUploadSize},
+		})
+		return
+	}
+	if maxSize > 0 && ctx.Request.ContentLength > maxSize {
+		ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrFileTooLarge},
+		})
+		return
+	}
+	body := ctx.Request.Body
+	if maxSize > 0 {
+		body = http.MaxBytesReader(ctx.Writer, body, maxSize)
+	}
+
+	contentType := ctx.ContentType()
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if _, err := lfh.localFileManager.UploadFile(fileName, body, ctx.Request.ContentLength, contentType, bucketName); err != nil {
+		status, err := http.StatusInternalServerError, errs.ErrUnableToUploadFile
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status, err = http.StatusRequestEntityTooLarge, errs.ErrFileTooLarge
+		}
+		ctx.AbortWithStatusJSON(status, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{err},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+	})
+}
+
+// verify aborts the request unless its URL was signed for its method, bucket and file
+func (lfh *LocalFileHandler) verify(ctx *gin.Context) (string, string, bool) {
+	bucketName := ctx.Param("bucket")
+	fileName := strings.TrimPrefix(ctx.Param("key"), "/")
+	err := lfh.localFileManager.VerifySignature(ctx.Request.Method, bucketName, fileName, ctx.Query("expires"), ctx.Query("signature"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{err},
+		})
+		return "", "", false
+	}
+	return bucketName, fileName, true
+}
+
+// isInlineContentType tells whether the content type is an image, SVG images run scripts and are not one
+func isInlineContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml"
+}
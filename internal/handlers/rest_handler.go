@@ -1,28 +1,36 @@
 package handlers
 
 import (
+	"bytes"
 	"fmt"
 	"log"
 	"net/http"
-	"path/filepath"
+	"slices"
 	"socketChat/internal/enums"
 	"socketChat/internal/errs"
 	"socketChat/internal/models"
+	socketModels "socketChat/internal/models/socket"
 	"socketChat/internal/msgs"
 	"socketChat/internal/services"
 	"socketChat/internal/utils"
-	"time"
 
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 type RestHandler struct {
-	authService        *services.AuthenticationService
-	chatService        *services.ChatService
-	whiteboardService  *services.WhiteboardService
-	fileManagerService *services.FileManagerService
+	authService          *services.AuthenticationService
+	chatService          *services.ChatService
+	whiteboardService    *services.WhiteboardService
+	fileManagerService   *services.FileManagerService
+	attachmentService    *services.AttachmentService
+	thumbnailService     *services.ThumbnailService
+	uploadService        *services.UploadService
+	fileValidatorService *services.FileValidatorService
+	storageService       *services.StorageService
+	socketChatHandler    *SocketChatHandler
 }
 
 func NewRestandler(
@@ -30,12 +38,24 @@ func NewRestandler(
 	chatService *services.ChatService,
 	whiteboardService *services.WhiteboardService,
 	fileManagerService *services.FileManagerService,
+	attachmentService *services.AttachmentService,
+	thumbnailService *services.ThumbnailService,
+	uploadService *services.UploadService,
+	fileValidatorService *services.FileValidatorService,
+	storageService *services.StorageService,
+	socketChatHandler *SocketChatHandler,
 ) *RestHandler {
 	return &RestHandler{
-		authService:        authService,
-		chatService:        chatService,
-		whiteboardService:  whiteboardService,
-		fileManagerService: fileManagerService,
+		authService:          authService,
+		chatService:          chatService,
+		whiteboardService:    whiteboardService,
+		fileManagerService:   fileManagerService,
+		attachmentService:    attachmentService,
+		thumbnailService:     thumbnailService,
+		uploadService:        uploadService,
+		fileValidatorService: fileValidatorService,
+		storageService:       storageService,
+		socketChatHandler:    socketChatHandler,
 	}
 }
 
@@ -435,29 +455,513 @@ func (rh *RestHandler) UploadUserProfilePhoto(ctx *gin.Context) {
 	}
 	defer src.Close()
 
-	// Generate a unique file name based on user ID and original file extension
-	fileExt := filepath.Ext(file.Filename)
-	// to avoid client side caching after profile photo upload
-	random := time.Now().Unix()
-	fileName := fmt.Sprintf("user_profile_photo_%s_%d%s", strconv.Itoa(int(userID)), random, fileExt)
+	// The uploaded content type and extension are not trusted
+	validated, err := rh.fileValidatorService.Validate(enums.FILE_BUCKET_USER_PROFILE, src, file.Size)
+	if err != nil {
+		ctx.AbortWithStatusJSON(fileValidationStatus([]error{err}, http.StatusBadRequest), models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{err},
+		})
+		return
+	}
+
+	// Avatars are stored cropped and resized, whatever was uploaded
+	avatar, thumbnail, blurhash, err := rh.thumbnailService.ResizeAvatar(validated.File)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err != errs.ErrInvalidImage && err != errs.ErrImageTooLarge {
+			log.Printf("RestHandler / UploadUserProfilePhoto / Error resizing photo of user %v: %v", userID, err)
+			status, err = http.StatusInternalServerError, errs.ErrUnableToUpdateProfilePhoto
+		}
+		ctx.AbortWithStatusJSON(status, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{err},
+		})
+		return
+	}
+
+	// Photos are stored by content, their URLs change with the content and uploading the same photo again stores nothing
+	bucket := enums.FILE_BUCKET_USER_PROFILE
+	stored, storeErrs := rh.storageService.Store(userID, bucket, bytes.NewReader(avatar.Data), int64(len(avatar.Data)), avatar.ContentType, avatar.Extension)
+	if len(storeErrs) > 0 {
+		ctx.AbortWithStatusJSON(fileValidationStatus(storeErrs, http.StatusInternalServerError), models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{storageError(storeErrs)},
+		})
+		return
+	}
+	storedThumbnail, storeErrs := rh.storageService.Store(userID, bucket, bytes.NewReader(thumbnail.Data), int64(len(thumbnail.Data)), thumbnail.ContentType, thumbnail.Extension)
+	if len(storeErrs) > 0 {
+		rh.releaseProfilePhoto(userID, stored.URL)
+		ctx.AbortWithStatusJSON(fileValidationStatus(storeErrs, http.StatusInternalServerError), models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{storageError(storeErrs)},
+		})
+		return
+	}
+
+	profilePhoto := &models.ProfilePhotoResponse{
+		ProfilePhoto:          stored.URL,
+		ProfilePhotoThumbnail: storedThumbnail.URL,
+		ProfilePhotoBlurhash:  blurhash,
+	}
+
+	// Update the user profile photo URLs in the database
+	previous, updateErrs := rh.authService.UpdateUserProfilePhoto(userID, profilePhoto)
+	if len(updateErrs) > 0 {
+		rh.releaseProfilePhoto(userID, stored.URL, storedThumbnail.URL)
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrUnableToUpdateProfilePhoto},
+		})
+		return
+	}
+	rh.releaseProfilePhoto(userID, previous.ProfilePhoto, previous.ProfilePhotoThumbnail)
+
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+		Data:    profilePhoto,
+	})
+}
+
+// storageError hides why a file could not be stored, unless it is over the quota
+func storageError(storeErrs []error) error {
+	if slices.Contains(storeErrs, error(errs.ErrStorageQuotaExceeded)) {
+		return errs.ErrStorageQuotaExceeded
+	}
+	return errs.ErrUnableToUploadFile
+}
+
+// releaseProfilePhoto drops the references of the user to the stored files of a profile photo
+func (rh *RestHandler) releaseProfilePhoto(userID uint, urls ...string) {
+	for _, url := range urls {
+		if releaseErrs := rh.storageService.ReleaseUrl(userID, enums.FILE_BUCKET_USER_PROFILE, url); len(releaseErrs) > 0 {
+			log.Printf("RestHandler / releaseProfilePhoto / Error releasing %v of user %v: %v", url, userID, releaseErrs)
+		}
+	}
+}
+
+func (rh *RestHandler) UploadAttachment(ctx *gin.Context) {
+	uploaderID := utils.GetUserIdFromContext(ctx)
+	if uploaderID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrUnauthorized},
+		})
+		return
+	}
+
+	file, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrNoFileUploaded},
+		})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrUnableToOpenUploadedFile},
+		})
+		return
+	}
+	defer src.Close()
+
+	attachment, uploadErrs := rh.attachmentService.UploadAttachment(uploaderID, file.Filename, src, file.Size)
+	if len(uploadErrs) > 0 {
+		ctx.AbortWithStatusJSON(fileValidationStatus(uploadErrs, http.StatusInternalServerError), models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  uploadErrs,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+		Data:    attachment,
+	})
+}
+
+func (rh *RestHandler) CreateAttachmentUploadUrl(ctx *gin.Context) {
+	uploaderID := utils.GetUserIdFromContext(ctx)
+	if uploaderID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrUnauthorized},
+		})
+		return
+	}
+
+	var uploadUrlRequest models.UploadUrlRequest
+	if err := ctx.ShouldBindJSON(&uploadUrlRequest); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrInvalidRequest},
+		})
+		return
+	}
+
+	uploadUrl, uploadUrlErrs := rh.attachmentService.CreateUploadUrl(uploaderID, &uploadUrlRequest)
+	if len(uploadUrlErrs) > 0 {
+		status := http.StatusInternalServerError
+		if slices.Contains(uploadUrlErrs, error(errs.ErrInvalidConversationId)) {
+			status = http.StatusForbidden
+		} else if slices.Contains(uploadUrlErrs, error(errs.ErrInvalidRequestBody)) {
+			status = http.StatusBadRequest
+		}
+		ctx.AbortWithStatusJSON(status, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  uploadUrlErrs,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+		Data:    uploadUrl,
+	})
+}
+
+func (rh *RestHandler) CompleteAttachmentUpload(ctx *gin.Context) {
+	uploaderID := utils.GetUserIdFromContext(ctx)
+	if uploaderID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrUnauthorized},
+		})
+		return
+	}
+
+	var completeUploadRequest models.CompleteUploadRequest
+	if err := ctx.ShouldBindJSON(&completeUploadRequest); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrInvalidRequest},
+		})
+		return
+	}
+
+	attachment, completeErrs := rh.attachmentService.CompleteUpload(uploaderID, &completeUploadRequest)
+	if len(completeErrs) > 0 {
+		status := fileValidationStatus(completeErrs, http.StatusInternalServerError)
+		if slices.Contains(completeErrs, error(errs.ErrFileNotFound)) {
+			status = http.StatusNotFound
+		} else if slices.Contains(completeErrs, error(errs.ErrInvalidObjectKey)) || slices.Contains(completeErrs, error(errs.ErrInvalidRequestBody)) {
+			status = http.StatusBadRequest
+		}
+		ctx.AbortWithStatusJSON(status, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  completeErrs,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+		Data:    attachment,
+	})
+}
+
+// GetAttachmentUrl returns a short-lived download URL of the attachment,
+// or of one of its thumbnails with ?variant=<size>
+func (rh *RestHandler) GetAttachmentUrl(ctx *gin.Context) {
+	userID := utils.GetUserIdFromContext(ctx)
+	if userID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrUnauthorized},
+		})
+		return
+	}
+
+	attachmentID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || attachmentID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrInvalidParams},
+		})
+		return
+	}
+	variantSize, err := strconv.Atoi(ctx.DefaultQuery("variant", "0"))
+	if err != nil || variantSize < 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrInvalidParams},
+		})
+		return
+	}
+
+	signedUrl, urlErrs := rh.attachmentService.GetAttachmentUrl(uint(attachmentID), userID, variantSize)
+	if len(urlErrs) > 0 {
+		status := http.StatusInternalServerError
+		switch {
+		case slices.Contains(urlErrs, error(errs.ErrAttachmentNotFound)) || slices.Contains(urlErrs, error(errs.ErrFileNotFound)):
+			status = http.StatusNotFound
+		case slices.Contains(urlErrs, error(errs.ErrAttachmentQuarantined)):
+			status = http.StatusForbidden
+		case slices.Contains(urlErrs, error(errs.ErrAttachmentNotScanned)):
+			status = http.StatusConflict
+		}
+		ctx.AbortWithStatusJSON(status, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  urlErrs,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+		Data:    signedUrl,
+	})
+}
+
+// Headers of the resumable upload protocol, named after their tus counterparts
+const (
+	uploadOffsetHeader  = "Upload-Offset"
+	uploadLengthHeader  = "Upload-Length"
+	uploadExpiresHeader = "Upload-Expires"
+)
+
+func (rh *RestHandler) CreateUpload(ctx *gin.Context) {
+	uploaderID := utils.GetUserIdFromContext(ctx)
+	if uploaderID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrUnauthorized},
+		})
+		return
+	}
+
+	var createUploadRequest models.CreateUploadRequest
+	if err := ctx.ShouldBindJSON(&createUploadRequest); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrInvalidRequest},
+		})
+		return
+	}
+
+	upload, createErrs := rh.uploadService.CreateUpload(uploaderID, &createUploadRequest)
+	if len(createErrs) > 0 {
+		status := http.StatusInternalServerError
+		if slices.Contains(createErrs, error(errs.ErrInvalidUploadSize)) || slices.Contains(createErrs, error(errs.ErrInvalidRequestBody)) {
+			status = http.StatusBadRequest
+		}
+		if slices.Contains(createErrs, error(errs.ErrStorageQuotaExceeded)) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		ctx.AbortWithStatusJSON(status, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  createErrs,
+		})
+		return
+	}
+
+	setUploadHeaders(ctx, upload)
+	ctx.Header("Location", fmt.Sprintf("%s/%d", strings.TrimSuffix(ctx.FullPath(), "/"), upload.ID))
+	ctx.JSON(http.StatusCreated, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+		Data:    upload,
+	})
+}
+
+// GetUpload reports the progress of an upload, HEAD requests get the headers only
+func (rh *RestHandler) GetUpload(ctx *gin.Context) {
+	uploaderID, uploadID, ok := parseUploadRequest(ctx)
+	if !ok {
+		return
+	}
+
+	upload, getErrs := rh.uploadService.GetUpload(uploadID, uploaderID)
+	if len(getErrs) > 0 {
+		abortUploadRequest(ctx, getErrs)
+		return
+	}
+
+	setUploadHeaders(ctx, upload)
+	if ctx.Request.Method == http.MethodHead {
+		ctx.Status(http.StatusOK)
+		return
+	}
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+		Data:    upload,
+	})
+}
+
+// PatchUpload appends the request body to the upload at the offset given in the Upload-Offset header
+func (rh *RestHandler) PatchUpload(ctx *gin.Context) {
+	uploaderID, uploadID, ok := parseUploadRequest(ctx)
+	if !ok {
+		return
+	}
+
+	offset, err := strconv.ParseInt(ctx.GetHeader(uploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 || ctx.Request.ContentLength < 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrInvalidParams},
+		})
+		return
+	}
+
+	upload, writeErrs := rh.uploadService.WriteChunk(uploadID, uploaderID, offset, ctx.Request.Body, ctx.Request.ContentLength)
+	if len(writeErrs) > 0 {
+		abortUploadRequest(ctx, writeErrs)
+		return
+	}
+
+	setUploadHeaders(ctx, upload)
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+		Data:    upload,
+	})
+}
+
+func (rh *RestHandler) CompleteUpload(ctx *gin.Context) {
+	uploaderID, uploadID, ok := parseUploadRequest(ctx)
+	if !ok {
+		return
+	}
+
+	attachment, completeErrs := rh.uploadService.CompleteUpload(uploadID, uploaderID)
+	if len(completeErrs) > 0 {
+		abortUploadRequest(ctx, completeErrs)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+		Data:    attachment,
+	})
+}
+
+func (rh *RestHandler) AbortUpload(ctx *gin.Context) {
+	uploaderID, uploadID, ok := parseUploadRequest(ctx)
+	if !ok {
+		return
+	}
+
+	if abortErrs := rh.uploadService.AbortUpload(uploadID, uploaderID); len(abortErrs) > 0 {
+		abortUploadRequest(ctx, abortErrs)
+		return
+	}
 
-	// Upload the file to MinIO
-	url, err := rh.fileManagerService.UploadUserProfilePhoto(fileName, src, file.Size, file.Header.Get("Content-Type"), enums.FILE_BUCKET_USER_PROFILE)
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, models.Response{
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+	})
+}
+
+func parseUploadRequest(ctx *gin.Context) (uint, uint, bool) {
+	uploaderID := utils.GetUserIdFromContext(ctx)
+	if uploaderID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrUnauthorized},
+		})
+		return 0, 0, false
+	}
+
+	uploadID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || uploadID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
 			Success: false,
 			Message: msgs.MsgOperationFailed,
-			Errors:  []error{errs.ErrUnableToUploadFile},
+			Errors:  []error{errs.ErrInvalidParams},
+		})
+		return 0, 0, false
+	}
+	return uploaderID, uint(uploadID), true
+}
+
+func abortUploadRequest(ctx *gin.Context, uploadErrs []error) {
+	status := fileValidationStatus(uploadErrs, http.StatusInternalServerError)
+	switch {
+	case slices.Contains(uploadErrs, error(errs.ErrUploadNotFound)):
+		status = http.StatusNotFound
+	case slices.Contains(uploadErrs, error(errs.ErrUploadOffsetMismatch)), slices.Contains(uploadErrs, error(errs.ErrUploadIncomplete)):
+		status = http.StatusConflict
+	case slices.Contains(uploadErrs, error(errs.ErrChunkTooLarge)):
+		status = http.StatusRequestEntityTooLarge
+	}
+	ctx.AbortWithStatusJSON(status, models.Response{
+		Success: false,
+		Message: msgs.MsgOperationFailed,
+		Errors:  uploadErrs,
+	})
+}
+
+// GetStorageUsage returns the storage used by the user and their quota,
+// or those of one of their conversations with ?conversation_id=<id>
+func (rh *RestHandler) GetStorageUsage(ctx *gin.Context) {
+	userID := utils.GetUserIdFromContext(ctx)
+	if userID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrUnauthorized},
 		})
 		return
 	}
 
-	// Update the user profile photo URL in the database
-	if updateErrs := rh.authService.UpdateUserProfilePhoto(userID, url); updateErrs != nil {
+	var usage *models.StorageUsageResponse
+	var usageErrs []error
+	if ctx.Query("conversation_id") == "" {
+		usage, usageErrs = rh.storageService.GetUserUsage(userID)
+	} else {
+		conversationID, err := strconv.Atoi(ctx.Query("conversation_id"))
+		if err != nil || conversationID < 1 || !rh.chatService.CheckUserInConversation(userID, uint(conversationID)) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Message: msgs.MsgOperationFailed,
+				Errors:  []error{errs.ErrInvalidConversationId},
+			})
+			return
+		}
+		usage, usageErrs = rh.storageService.GetConversationUsage(uint(conversationID))
+	}
+	if len(usageErrs) > 0 {
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, models.Response{
 			Success: false,
 			Message: msgs.MsgOperationFailed,
-			Errors:  []error{errs.ErrUnableToUpdateProfilePhoto},
+			Errors:  usageErrs,
 		})
 		return
 	}
@@ -465,10 +969,33 @@ func (rh *RestHandler) UploadUserProfilePhoto(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, models.Response{
 		Success: true,
 		Message: msgs.MsgOperationSuccessful,
-		Data:    url,
+		Data:    usage,
 	})
 }
 
+// fileValidationStatus returns the status of uploads rejected by the file validator, fallback otherwise
+func fileValidationStatus(uploadErrs []error, fallback int) int {
+	switch {
+	case slices.Contains(uploadErrs, error(errs.ErrFileTooLarge)),
+		slices.Contains(uploadErrs, error(errs.ErrStorageQuotaExceeded)):
+		return http.StatusRequestEntityTooLarge
+	case slices.Contains(uploadErrs, error(errs.ErrFileTypeNotAllowed)):
+		return http.StatusUnsupportedMediaType
+	case slices.Contains(uploadErrs, error(errs.ErrMalformedFile)),
+		slices.Contains(uploadErrs, error(errs.ErrPolyglotFile)),
+		slices.Contains(uploadErrs, error(errs.ErrImageTooLarge)):
+		return http.StatusBadRequest
+	}
+	return fallback
+}
+
+func setUploadHeaders(ctx *gin.Context, upload *models.Upload) {
+	ctx.Header(uploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	ctx.Header(uploadLengthHeader, strconv.FormatInt(upload.Size, 10))
+	ctx.Header(uploadExpiresHeader, upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	ctx.Header("Cache-Control", "no-store")
+}
+
 func (rh *RestHandler) SaveMessage(ctx *gin.Context) {
 	senderID := utils.GetUserIdFromContext(ctx)
 	if senderID < 1 {
@@ -495,9 +1022,12 @@ func (rh *RestHandler) SaveMessage(ctx *gin.Context) {
 		ConversationID: messageRequest.ConversationID,
 		Content:        messageRequest.Content,
 		SenderID:       senderID,
+		ReplyToID:      messageRequest.ReplyToID,
+		ThreadRootID:   messageRequest.ThreadRootID,
+		ClientID:       messageRequest.ClientID,
 	}
 
-	msg, errs := rh.chatService.SaveMessage(message)
+	msg, _, errs := rh.chatService.SaveMessage(message, messageRequest.AttachmentIDs)
 	if len(errs) > 0 {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
 			Success: false,
@@ -552,7 +1082,17 @@ func (rh *RestHandler) GetMessagesByConversationID(ctx *gin.Context) {
 		return
 	}
 
-	messages, errs := rh.chatService.GetMessagesByConversationId(uint(conversationIdUint), pageInt, sizeInt)
+	userID := utils.GetUserIdFromContext(ctx)
+	if !rh.chatService.CheckUserInConversation(userID, uint(conversationIdUint)) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrInvalidConversationId},
+		})
+		return
+	}
+
+	messages, errs := rh.chatService.GetMessagesByConversationId(uint(conversationIdUint), userID, pageInt, sizeInt)
 	if len(errs) > 0 {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
 			Success: false,
@@ -562,6 +1102,260 @@ func (rh *RestHandler) GetMessagesByConversationID(ctx *gin.Context) {
 		return
 	}
 
+	rh.recordDeliveries(messages, userID)
+
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+		Data:    messages,
+	})
+}
+
+func (rh *RestHandler) EditMessage(ctx *gin.Context) {
+	editorID := utils.GetUserIdFromContext(ctx)
+	if editorID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrUnauthorized},
+		})
+		return
+	}
+
+	messageID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || messageID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrInvalidParams},
+		})
+		return
+	}
+
+	var editMessageRequest models.EditMessageRequest
+	if err := ctx.ShouldBindJSON(&editMessageRequest); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrInvalidRequest},
+		})
+		return
+	}
+
+	msg, editErrs := rh.chatService.EditMessage(uint(messageID), editorID, editMessageRequest.Content)
+	if len(editErrs) > 0 {
+		status := http.StatusBadRequest
+		if slices.Contains(editErrs, error(errs.ErrNotMessageSender)) {
+			status = http.StatusForbidden
+		}
+		ctx.AbortWithStatusJSON(status, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  editErrs,
+		})
+		return
+	}
+
+	// The edit is already stored, members that miss the event get it with the next history fetch
+	if err := rh.socketChatHandler.PublishEvent(enums.SOCKET_EVENT_MESSAGE_EDITED, msg.ConversationID, msg); err != nil {
+		log.Printf("RestHandler / EditMessage / Error publishing edit of message %v: %v", msg.ID, err)
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+		Data:    msg,
+	})
+}
+
+func (rh *RestHandler) DeleteMessage(ctx *gin.Context) {
+	userID := utils.GetUserIdFromContext(ctx)
+	if userID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrUnauthorized},
+		})
+		return
+	}
+
+	messageID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || messageID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrInvalidParams},
+		})
+		return
+	}
+
+	scope := ctx.DefaultQuery("scope", enums.MESSAGE_DELETE_SCOPE_ME)
+
+	msg, deleteErrs := rh.chatService.DeleteMessage(uint(messageID), userID, scope)
+	if len(deleteErrs) > 0 {
+		status := http.StatusBadRequest
+		if slices.Contains(deleteErrs, error(errs.ErrNotMessageSender)) || slices.Contains(deleteErrs, error(errs.ErrDeleteWindowExpired)) {
+			status = http.StatusForbidden
+		}
+		ctx.AbortWithStatusJSON(status, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  deleteErrs,
+		})
+		return
+	}
+
+	// Only deletes for everyone concern the other members
+	if msg != nil {
+		if err := rh.socketChatHandler.PublishEvent(enums.SOCKET_EVENT_MESSAGE_DELETED, msg.ConversationID, msg); err != nil {
+			log.Printf("RestHandler / DeleteMessage / Error publishing deletion of message %v: %v", msg.ID, err)
+		}
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+	})
+}
+
+func (rh *RestHandler) AddReaction(ctx *gin.Context) {
+	var reactionRequest models.ReactionRequest
+	if err := ctx.ShouldBindJSON(&reactionRequest); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrInvalidRequest},
+		})
+		return
+	}
+	rh.handleReaction(ctx, enums.SOCKET_EVENT_ADD_REACTION, reactionRequest.Emoji)
+}
+
+func (rh *RestHandler) RemoveReaction(ctx *gin.Context) {
+	rh.handleReaction(ctx, enums.SOCKET_EVENT_REMOVE_REACTION, ctx.Query("emoji"))
+}
+
+func (rh *RestHandler) handleReaction(ctx *gin.Context, event string, emoji string) {
+	userID := utils.GetUserIdFromContext(ctx)
+	if userID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrUnauthorized},
+		})
+		return
+	}
+
+	messageID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || messageID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrInvalidParams},
+		})
+		return
+	}
+
+	var msg *models.Message
+	var reactionErrs []error
+	if event == enums.SOCKET_EVENT_ADD_REACTION {
+		msg, reactionErrs = rh.chatService.AddReaction(uint(messageID), userID, emoji)
+	} else {
+		msg, reactionErrs = rh.chatService.RemoveReaction(uint(messageID), userID, emoji)
+	}
+	if len(reactionErrs) > 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  reactionErrs,
+		})
+		return
+	}
+
+	reaction := socketModels.ReactionPayload{
+		MessageID: msg.ID,
+		UserID:    userID,
+		Emoji:     emoji,
+	}
+	if err := rh.socketChatHandler.PublishEvent(event, msg.ConversationID, reaction); err != nil {
+		log.Printf("RestHandler / handleReaction / Error publishing %v on message %v: %v", event, msg.ID, err)
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+		Data:    reaction,
+	})
+}
+
+func (rh *RestHandler) GetMessageEdits(ctx *gin.Context) {
+	userID := utils.GetUserIdFromContext(ctx)
+
+	messageID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || messageID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrInvalidParams},
+		})
+		return
+	}
+
+	edits, editsErrs := rh.chatService.GetMessageEdits(uint(messageID), userID)
+	if len(editsErrs) > 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  editsErrs,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+		Data:    edits,
+	})
+}
+
+func (rh *RestHandler) GetThreadMessages(ctx *gin.Context) {
+	userID := utils.GetUserIdFromContext(ctx)
+
+	page := ctx.Query("page")
+	size := ctx.Query("size")
+
+	pageInt, err := strconv.Atoi(page)
+	if err != nil || pageInt < 1 {
+		pageInt = 1
+	}
+
+	sizeInt, err := strconv.Atoi(size)
+	if err != nil || sizeInt < 1 {
+		sizeInt = 10
+	}
+
+	threadRootID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || threadRootID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrInvalidParams},
+		})
+		return
+	}
+
+	messages, threadErrs := rh.chatService.GetThreadMessages(uint(threadRootID), userID, pageInt, sizeInt)
+	if len(threadErrs) > 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  threadErrs,
+		})
+		return
+	}
+
+	rh.recordDeliveries(messages, userID)
+
 	ctx.JSON(http.StatusOK, models.Response{
 		Success: true,
 		Message: msgs.MsgOperationSuccessful,
@@ -569,6 +1363,53 @@ func (rh *RestHandler) GetMessagesByConversationID(ctx *gin.Context) {
 	})
 }
 
+func (rh *RestHandler) GetThreadUnReadMessagesForUser(ctx *gin.Context) {
+	userID := utils.GetUserIdFromContext(ctx)
+
+	threadRootID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || threadRootID < 1 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrInvalidParams},
+		})
+		return
+	}
+
+	count, unreadErrs := rh.chatService.GetThreadUnReadMessagesForUser(uint(threadRootID), userID)
+	if len(unreadErrs) > 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  unreadErrs,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: msgs.MsgOperationSuccessful,
+		Data:    count,
+	})
+}
+
+// recordDeliveries marks the fetched messages as delivered to the user,
+// the history is served even if that fails
+func (rh *RestHandler) recordDeliveries(messages *models.MessageListResponse, userID uint) {
+	var messageIds []uint
+	for _, message := range messages.Messages {
+		if message.SenderID != userID && !message.IsDeleted {
+			messageIds = append(messageIds, message.ID)
+		}
+	}
+	if len(messageIds) == 0 {
+		return
+	}
+	if deliveryErrs := rh.socketChatHandler.RecordDeliveries(messageIds, userID); len(deliveryErrs) > 0 {
+		log.Printf("RestHandler / recordDeliveries / Error recording deliveries to user %v: %v", userID, deliveryErrs)
+	}
+}
+
 func (rh *RestHandler) UpdateUser(ctx *gin.Context) {
 	var errors []error
 	var updateUserRequest models.UpdateUserRequest
@@ -8,8 +8,10 @@ import (
 	"os"
 	"os/signal"
 	"slices"
+	"socketChat/configs"
 	"socketChat/internal/enums"
 	"socketChat/internal/errs"
+	"socketChat/internal/interfaces"
 	"socketChat/internal/models"
 	redisModels "socketChat/internal/models/redis"
 	socketModels "socketChat/internal/models/socket"
@@ -19,27 +21,61 @@ import (
 	"strconv"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
-	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultChatMaxReplayCount = 1000
+	// Time given to the close frame refusing a connection
+	chatRefuseTimeout = time.Second
 )
 
 type SocketChatHandler struct {
-	mu          sync.Mutex
-	ctx         context.Context
-	upgrader    websocket.Upgrader
-	hub         *models.SocketHub
-	chatService *services.ChatService
+	mu            sync.Mutex
+	ctx           context.Context
+	upgrader      websocket.Upgrader
+	hub           *models.SocketHub
+	chatService   *services.ChatService
+	broker        interfaces.Broker
+	clientOptions *models.SocketClientOptions
+	// [conversation_id] => broker message ID of the last event delivered to the conversation, guarded by mu.
+	// Only conversations with clients on this instance are subscribed to.
+	lastEventIds   map[uint]string
+	maxReplayCount int64
+	// Live events held back from clients while the events they missed are replayed, guarded by mu
+	replaying map[chatReplayKey][]redisModels.RedisPublishedMessage
+}
+
+// chatReplayKey identifies a client joining a conversation
+type chatReplayKey struct {
+	client         *models.SocketClient
+	conversationId uint
 }
 
-func NewSocketChatHandler(redis *redis.Client, ctx context.Context, chatService *services.ChatService) *SocketChatHandler {
+func NewSocketChatHandler(
+	broker interfaces.Broker,
+	ctx context.Context,
+	chatService *services.ChatService,
+	clientOptions *models.SocketClientOptions,
+	config *configs.Config,
+) *SocketChatHandler {
+	maxReplayCount := config.Viper.GetInt64("broker.max_replay_count")
+	if maxReplayCount <= 0 {
+		maxReplayCount = defaultChatMaxReplayCount
+	}
 	return &SocketChatHandler{
-		ctx:         ctx,
-		chatService: chatService,
+		ctx:            ctx,
+		chatService:    chatService,
+		broker:         broker,
+		clientOptions:  clientOptions,
+		maxReplayCount: maxReplayCount,
+		lastEventIds:   make(map[uint]string),
+		replaying:      make(map[chatReplayKey][]redisModels.RedisPublishedMessage),
 		hub: &models.SocketHub{
 			Conversations: make(map[uint][]*models.SocketClient),
-			Redis:         redis,
 			Mu:            sync.Mutex{},
 		},
 	}
@@ -116,12 +152,14 @@ func (sch *SocketChatHandler) HandleSocketChatRoute(ctx *gin.Context) {
 		return
 	}
 
-	sch.HandleConnections(ctx, userInfo, conversationIdUInt)
+	// Last event ID seen by the client before reconnecting, missed events are replayed
+	lastEventId := ctx.Query("lastEventId")
+
+	sch.HandleConnections(ctx, userInfo, conversationIdUInt, lastEventId)
 }
 
 func (sch *SocketChatHandler) StartSocket() {
 	sch.InitializeSocketUpgrader()
-	go sch.HandleRedisMessages()
 }
 
 func (sch *SocketChatHandler) InitializeSocketUpgrader() {
@@ -132,110 +170,144 @@ func (sch *SocketChatHandler) InitializeSocketUpgrader() {
 	}
 }
 
-func (sch *SocketChatHandler) HandleConnections(ctx *gin.Context, userInfo *models.Claims, conversationId uint) {
+func (sch *SocketChatHandler) HandleConnections(ctx *gin.Context, userInfo *models.Claims, conversationId uint, lastEventId string) {
 	ws, err := sch.upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade connection: %v", err)
 		return
 	}
-	defer func(ws *websocket.Conn) {
-		err := ws.Close()
-		if err != nil {
-			log.Printf("Error closing connection: %v", err)
-		}
-	}(ws)
+	client := models.NewSocketClient(ws, userInfo.ID, sch.clientOptions)
+	defer client.Close()
+
+	// Start delivering outbound events to the client
+	go client.WritePump()
 
 	// Handle disconnection
-	sch.handleDiconnectedClient(ws, userInfo.ID, conversationId)
+	sch.handleDiconnectedClient(client, conversationId)
 
-	// Add client to hub
-	sch.handleConversationAndClinet(userInfo.ID, conversationId, ws)
+	// Add client to hub, the connection is refused if the conversation events can't be received
+	if err := sch.handleConversationAndClinet(client, conversationId, lastEventId); err != nil {
+		closeMessage := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, errs.Code(err))
+		if err := client.Conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(chatRefuseTimeout)); err != nil {
+			log.Printf("HandleConnections / Error refusing connection of user %v: %v", client.UserId, err)
+		}
+		return
+	}
 
 	// Handle incoming messages
-	sch.handleIncommingMessagesWithEvent(ws, userInfo, conversationId)
+	sch.handleIncommingMessagesWithEvent(client, userInfo, conversationId)
 }
 
-func (sch *SocketChatHandler) handleDiconnectedClient(ws *websocket.Conn, userId uint, conversationId uint) {
-	ws.SetCloseHandler(func(code int, text string) error {
-		sch.deleteDiconnectedClientFromConversation(userId, conversationId)
+func (sch *SocketChatHandler) handleDiconnectedClient(client *models.SocketClient, conversationId uint) {
+	client.Conn.SetCloseHandler(func(code int, text string) error {
+		sch.deleteDiconnectedClientFromConversation(client, conversationId)
 		return nil
 	})
 }
 
-func (sch *SocketChatHandler) handleConversationAndClinet(userId uint, conversationId uint, ws *websocket.Conn) {
+// handleConversationAndClinet adds the client to the conversation and replays the events it missed after lastEventId.
+// The first client of the conversation on this instance subscribes to its events, the client is not added if that fails.
+// Broker round trips are made without holding sch.mu.
+func (sch *SocketChatHandler) handleConversationAndClinet(client *models.SocketClient, conversationId uint, lastEventId string) error {
 	sch.mu.Lock()
-	// Add conversation to hub if not exists
-	if _, ok := sch.hub.Conversations[conversationId]; !ok {
-		sch.hub.Conversations[conversationId] = []*models.SocketClient{}
+	for {
+		if _, subscribed := sch.lastEventIds[conversationId]; subscribed {
+			break
+		}
+		sch.mu.Unlock()
+		lastId, err := sch.broker.LastID(redisModels.ChatConversationChannel(conversationId))
+		if err != nil {
+			log.Printf("handleConversationAndClinet / Could not get last event of conversation %v: %v", conversationId, err)
+			return errs.ErrSubscriptionFailed
+		}
+		sch.mu.Lock()
+		// Another client may have subscribed in the meantime
+		if _, subscribed := sch.lastEventIds[conversationId]; subscribed {
+			break
+		}
+		if err := sch.subscribeToConversation(conversationId, lastId); err != nil {
+			sch.mu.Unlock()
+			log.Printf("handleConversationAndClinet / Could not subscribe to conversation %v: %v", conversationId, err)
+			return errs.ErrSubscriptionFailed
+		}
 	}
 	// Add client to conversation if not exists
-	if isMember := slices.Contains(sch.hub.Conversations[conversationId], &models.SocketClient{Conn: ws}); !isMember {
-		sch.hub.Conversations[conversationId] =
-			append(sch.hub.Conversations[conversationId],
-				&models.SocketClient{
-					Conn:   ws,
-					UserId: userId,
-				},
-			)
+	if isMember := slices.Contains(sch.hub.Conversations[conversationId], client); !isMember {
+		sch.hub.Conversations[conversationId] = append(sch.hub.Conversations[conversationId], client)
+	}
+	// Live events newer than untilId are held back until the missed ones up to it are replayed
+	untilId := sch.lastEventIds[conversationId]
+	if lastEventId != "" {
+		sch.replaying[chatReplayKey{client: client, conversationId: conversationId}] = nil
 	}
 	sch.mu.Unlock()
 
+	if lastEventId != "" {
+		sch.replayMissedEvents(client, conversationId, lastEventId, untilId)
+	}
+
 	// Log conversations for debug purposes
 	sch.logConversations()
+	return nil
 }
 
-func (sch *SocketChatHandler) handleIncommingMessagesWithEvent(ws *websocket.Conn, userInfo *models.Claims, conversationId uint) {
+func (sch *SocketChatHandler) handleIncommingMessagesWithEvent(client *models.SocketClient, userInfo *models.Claims, conversationId uint) {
 	for {
 		// Read message from client
 		var event socketModels.SocketEvent
-		err := ws.ReadJSON(&event)
+		err := client.Conn.ReadJSON(&event)
 		if err != nil {
-			if websocket.IsCloseError(err,
-				websocket.CloseAbnormalClosure,
-				websocket.CloseNormalClosure,
-				websocket.CloseNoStatusReceived,
-			) {
-				log.Printf("SocketChatHandler / handleIncommingMessagesWithEvent / connection closed by client side - Error: %v", err)
-				sch.deleteDiconnectedClientFromConversation(userInfo.ID, conversationId)
-				break
+			if isMalformedMessageError(err) {
+				log.Printf("Error reading json: %v", err)
+				continue
 			}
-			log.Printf("Error reading json: %v", err)
-			continue
+			log.Printf("SocketChatHandler / handleIncommingMessagesWithEvent / connection closed - Error: %v", err)
+			sch.deleteDiconnectedClientFromConversation(client, conversationId)
+			break
 		}
 
 		// Set event conversation id
 		event.ConversationID = conversationId
 
 		// Handle event
-		switch event.Event {
-		case enums.SOCKET_EVENT_SEND_MESSAGE:
-			errs := sch.handleSendMessageEvent(event.Payload, enums.SOCKET_EVENT_SEND_MESSAGE, userInfo, conversationId)
-			if len(errs) > 0 {
-				log.Printf("handleIncommingMessagesWithEvent - Error while handling send message event: %v", errs)
-			}
-		case enums.SOCKET_EVENT_SEEN_MESSAGE:
-			errs := sch.handleSeenMessageEvent(event.Payload, enums.SOCKET_EVENT_SEEN_MESSAGE, conversationId, userInfo.ID)
-			if len(errs) > 0 {
-				log.Printf("handleIncommingMessagesWithEvent - Error while handling seen message event: %v", errs)
-			}
-		case enums.SOCKET_EVENT_IS_TYPING:
-			errs := sch.handleIsTypingEvent(event.Payload, enums.SOCKET_EVENT_IS_TYPING, conversationId)
-			if len(errs) > 0 {
-				log.Printf("handleIncommingMessagesWithEvent - Error while handling is typing event: %v", errs)
-			}
-		default:
-			log.Printf("Unknown event: %v", event)
+		entity, errs := sch.handleEvent(userInfo, conversationId, event.Event, event.Payload)
+		if len(errs) > 0 {
+			log.Printf("handleIncommingMessagesWithEvent - Error while handling %v event: %v", event.Event, errs)
+		}
+		if event.RequestID != "" {
+			client.Send(newSocketAck(event.RequestID, event.Event, entity, errs))
 		}
 	}
 }
 
-func (sch *SocketChatHandler) handleIsTypingEvent(payload json.RawMessage, event string, conversationId uint) []error {
+func (sch *SocketChatHandler) handleEvent(userInfo *models.Claims, conversationId uint, event string, payload json.RawMessage) (any, []error) {
+	switch event {
+	case enums.SOCKET_EVENT_SEND_MESSAGE:
+		return sch.handleSendMessageEvent(payload, event, userInfo, conversationId)
+	case enums.SOCKET_EVENT_SEEN_MESSAGE:
+		return sch.handleSeenMessageEvent(payload, event, conversationId, userInfo.ID)
+	case enums.SOCKET_EVENT_IS_TYPING:
+		return sch.handleIsTypingEvent(payload, event, conversationId)
+	case enums.SOCKET_EVENT_EDIT_MESSAGE:
+		return sch.handleEditMessageEvent(payload, conversationId, userInfo.ID)
+	case enums.SOCKET_EVENT_DELETE_MESSAGE:
+		return sch.handleDeleteMessageEvent(payload, conversationId, userInfo.ID)
+	case enums.SOCKET_EVENT_ADD_REACTION, enums.SOCKET_EVENT_REMOVE_REACTION:
+		return sch.handleReactionEvent(payload, event, conversationId, userInfo.ID)
+	case enums.SOCKET_EVENT_MARK_READ_UP_TO:
+		return sch.handleMarkReadUpToEvent(payload, event, conversationId, userInfo.ID)
+	default:
+		return nil, []error{errs.ErrUnknownSocketEvent}
+	}
+}
+
+func (sch *SocketChatHandler) handleIsTypingEvent(payload json.RawMessage, event string, conversationId uint) (any, []error) {
 	var errors []error
 	var isTypingPayload socketModels.IsTypingPayload
 	err := json.Unmarshal(payload, &isTypingPayload)
 	if err != nil {
 		errors = append(errors, errs.ErrInvalidRequest)
-		return errors
+		return nil, errors
 	}
 
 	log.Println("isTypingPayload: ", isTypingPayload)
@@ -250,24 +322,23 @@ func (sch *SocketChatHandler) handleIsTypingEvent(payload json.RawMessage, event
 	jsonEvent, err := json.Marshal(redisEvent)
 	if err != nil {
 		errors = append(errors, err)
-		return errors
+		return nil, errors
 	}
 	log.Println("jsonEvent: ", string(jsonEvent))
-	if err := sch.PublishMessage(sch.hub.Redis, redisModels.REDIS_CHANNEL_CHAT, jsonEvent); err != nil {
+	if err := sch.PublishMessage(redisModels.ChatConversationChannel(conversationId), jsonEvent); err != nil {
 		errors = append(errors, err)
-		return errors
+		return nil, errors
 	}
-	return nil
+	return nil, nil
 }
 
-func (sch *SocketChatHandler) handleSendMessageEvent(payload json.RawMessage, event string, userInfo *models.Claims, conversationId uint) []error {
+func (sch *SocketChatHandler) handleSendMessageEvent(payload json.RawMessage, event string, userInfo *models.Claims, conversationId uint) (any, []error) {
 	var errors []error
 	var messageRequest models.MessageRequest
 	err := json.Unmarshal(payload, &messageRequest)
 	if err != nil {
 		errors = append(errors, errs.ErrInvalidRequest)
-		sch.deleteDiconnectedClientFromConversation(userInfo.ID, conversationId)
-		return errors
+		return nil, errors
 	}
 
 	// Save message in DB
@@ -275,48 +346,56 @@ func (sch *SocketChatHandler) handleSendMessageEvent(payload json.RawMessage, ev
 		ConversationID: conversationId,
 		Content:        messageRequest.Content,
 		SenderID:       userInfo.ID,
+		ReplyToID:      messageRequest.ReplyToID,
+		ThreadRootID:   messageRequest.ThreadRootID,
+		ClientID:       messageRequest.ClientID,
 	}
-	savedMessage, saveMsgErrs := sch.chatService.SaveMessage(message)
+	savedMessage, duplicate, saveMsgErrs := sch.chatService.SaveMessage(message, messageRequest.AttachmentIDs)
 	if len(saveMsgErrs) > 0 {
 		errors = append(errors, saveMsgErrs...)
-		return errors
+		return nil, errors
+	}
+	// Retried sends were broadcast the first time, they are only acknowledged
+	if duplicate {
+		return savedMessage, nil
 	}
 
 	// Publish the new message to Redis
 	redisEvent := redisModels.RedisPublishedMessage{
 		Event:          event,
 		ConversationID: conversationId,
+		ThreadRootID:   savedMessage.ThreadRootID,
 		Payload:        savedMessage,
 	}
 
 	jsonEvent, err := json.Marshal(redisEvent)
 	if err != nil {
 		errors = append(errors, err)
-		return errors
+		return nil, errors
 	}
-	if err := sch.PublishMessage(sch.hub.Redis, redisModels.REDIS_CHANNEL_CHAT, jsonEvent); err != nil {
+	if err := sch.PublishMessage(redisModels.ChatConversationChannel(conversationId), jsonEvent); err != nil {
 		errors = append(errors, err)
-		return errors
+		return nil, errors
 	}
-	return nil
+	return savedMessage, nil
 }
 
-func (sch *SocketChatHandler) handleSeenMessageEvent(payload json.RawMessage, event string, conversationId, seenerId uint) []error {
+func (sch *SocketChatHandler) handleSeenMessageEvent(payload json.RawMessage, event string, conversationId, seenerId uint) (any, []error) {
 	var errors []error
 	var seenData socketModels.SeenMessagePayload
 	err := json.Unmarshal(payload, &seenData)
 	if err != nil {
-		errors = append(errors, err)
-		return errors
+		errors = append(errors, errs.ErrInvalidRequest)
+		return nil, errors
 	}
 
-	log.Println("seenData: ", seenData)
+	seenData.UserID = seenerId
 
 	// Mark message as seen in DB
-	errs := sch.chatService.SeenMessage(seenData.MessageIds, seenerId)
+	errs := sch.chatService.SeenMessage(conversationId, seenData.MessageIds, seenerId)
 	if len(errs) > 0 {
 		errors = append(errors, errs...)
-		return errors
+		return nil, errors
 	}
 	// Publish the new message to Redis
 	redisEvent := redisModels.RedisPublishedMessage{
@@ -329,28 +408,166 @@ func (sch *SocketChatHandler) handleSeenMessageEvent(payload json.RawMessage, ev
 	jsonEvent, err := json.Marshal(redisEvent)
 	if err != nil {
 		errors = append(errors, err)
-		return errors
+		return nil, errors
 	}
-	if err := sch.PublishMessage(sch.hub.Redis, redisModels.REDIS_CHANNEL_CHAT, jsonEvent); err != nil {
+	if err := sch.PublishMessage(redisModels.ChatConversationChannel(conversationId), jsonEvent); err != nil {
 		errors = append(errors, err)
-		return errors
+		return nil, errors
 	}
-	return nil
+	return seenData, nil
+}
+
+func (sch *SocketChatHandler) handleEditMessageEvent(payload json.RawMessage, conversationId, editorId uint) (any, []error) {
+	var errors []error
+	var editData socketModels.EditMessagePayload
+	err := json.Unmarshal(payload, &editData)
+	if err != nil {
+		errors = append(errors, errs.ErrInvalidRequest)
+		return nil, errors
+	}
+
+	// Messages of other conversations can't be edited through this one
+	message, getErrs := sch.chatService.GetMessageById(editData.MessageID)
+	if len(getErrs) > 0 {
+		errors = append(errors, getErrs...)
+		return nil, errors
+	}
+	if message.ConversationID != conversationId {
+		errors = append(errors, errs.ErrMessageNotFound)
+		return nil, errors
+	}
+
+	editedMessage, editErrs := sch.chatService.EditMessage(editData.MessageID, editorId, editData.Content)
+	if len(editErrs) > 0 {
+		errors = append(errors, editErrs...)
+		return nil, errors
+	}
+
+	if err := sch.PublishEvent(enums.SOCKET_EVENT_MESSAGE_EDITED, editedMessage.ConversationID, editedMessage); err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return editedMessage, nil
+}
+
+func (sch *SocketChatHandler) handleDeleteMessageEvent(payload json.RawMessage, conversationId, userId uint) (any, []error) {
+	var errors []error
+	var deleteData socketModels.DeleteMessagePayload
+	err := json.Unmarshal(payload, &deleteData)
+	if err != nil {
+		errors = append(errors, errs.ErrInvalidRequest)
+		return nil, errors
+	}
+
+	// Messages of other conversations can't be deleted through this one
+	message, getErrs := sch.chatService.GetMessageById(deleteData.MessageID)
+	if len(getErrs) > 0 {
+		errors = append(errors, getErrs...)
+		return nil, errors
+	}
+	if message.ConversationID != conversationId {
+		errors = append(errors, errs.ErrMessageNotFound)
+		return nil, errors
+	}
+
+	deletedMessage, deleteErrs := sch.chatService.DeleteMessage(deleteData.MessageID, userId, deleteData.Scope)
+	if len(deleteErrs) > 0 {
+		errors = append(errors, deleteErrs...)
+		return nil, errors
+	}
+
+	// Deletes for the user only are not broadcast
+	if deletedMessage == nil {
+		return nil, nil
+	}
+	if err := sch.PublishEvent(enums.SOCKET_EVENT_MESSAGE_DELETED, deletedMessage.ConversationID, deletedMessage); err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return deletedMessage, nil
+}
+
+func (sch *SocketChatHandler) handleReactionEvent(payload json.RawMessage, event string, conversationId, userId uint) (any, []error) {
+	var errors []error
+	var reactionData socketModels.ReactionPayload
+	err := json.Unmarshal(payload, &reactionData)
+	if err != nil {
+		errors = append(errors, errs.ErrInvalidRequest)
+		return nil, errors
+	}
+	reactionData.UserID = userId
+
+	// Messages of other conversations can't be reacted to through this one
+	message, getErrs := sch.chatService.GetMessageById(reactionData.MessageID)
+	if len(getErrs) > 0 {
+		errors = append(errors, getErrs...)
+		return nil, errors
+	}
+	if message.ConversationID != conversationId {
+		errors = append(errors, errs.ErrMessageNotFound)
+		return nil, errors
+	}
+
+	var reactionErrs []error
+	if event == enums.SOCKET_EVENT_ADD_REACTION {
+		message, reactionErrs = sch.chatService.AddReaction(reactionData.MessageID, userId, reactionData.Emoji)
+	} else {
+		message, reactionErrs = sch.chatService.RemoveReaction(reactionData.MessageID, userId, reactionData.Emoji)
+	}
+	if len(reactionErrs) > 0 {
+		errors = append(errors, reactionErrs...)
+		return nil, errors
+	}
+
+	if err := sch.PublishEvent(event, message.ConversationID, reactionData); err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return reactionData, nil
 }
 
-func (sch *SocketChatHandler) deleteDiconnectedClientFromConversation(userId uint, conversationId uint) {
+func (sch *SocketChatHandler) handleMarkReadUpToEvent(payload json.RawMessage, event string, conversationId, userId uint) (any, []error) {
+	var errors []error
+	var readData socketModels.MarkReadUpToPayload
+	err := json.Unmarshal(payload, &readData)
+	if err != nil {
+		errors = append(errors, errs.ErrInvalidRequest)
+		return nil, errors
+	}
+	readData.UserID = userId
+
+	advanced, markErrs := sch.chatService.MarkReadUpTo(conversationId, userId, readData.MessageID)
+	if len(markErrs) > 0 {
+		errors = append(errors, markErrs...)
+		return nil, errors
+	}
+	// Receipts only change when the cursor moves forward
+	if !advanced {
+		return readData, nil
+	}
+
+	if err := sch.PublishEvent(event, conversationId, readData); err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return readData, nil
+}
+
+func (sch *SocketChatHandler) deleteDiconnectedClientFromConversation(disconnected *models.SocketClient, conversationId uint) {
 	sch.mu.Lock()
 	defer sch.mu.Unlock()
+	delete(sch.replaying, chatReplayKey{client: disconnected, conversationId: conversationId})
 	// Remove disconnected client from conversation
 	for i, client := range sch.hub.Conversations[conversationId] {
-		if client.UserId == userId {
+		if client == disconnected {
 			sch.hub.Conversations[conversationId] = append(sch.hub.Conversations[conversationId][:i], sch.hub.Conversations[conversationId][i+1:]...)
 			break
 		}
 	}
-	// Check if the conversation is empty and remove it from the map
-	if len(sch.hub.Conversations[conversationId]) == 0 {
+	// Check if the conversation is empty, remove it from the map and stop receiving its events
+	if clients, ok := sch.hub.Conversations[conversationId]; ok && len(clients) == 0 {
 		delete(sch.hub.Conversations, conversationId)
+		sch.unsubscribeFromConversation(conversationId)
 	}
 	// Log conversations for debug purposes
 	sch.logConversations()
@@ -365,46 +582,251 @@ func (sch *SocketChatHandler) logConversations() {
 	}
 }
 
-func (sch *SocketChatHandler) HandleRedisMessages() {
-	ch := sch.SubscribeToChannel(sch.hub.Redis, redisModels.REDIS_CHANNEL_CHAT)
-	for msg := range ch {
-		var redisMessage redisModels.RedisPublishedMessage
-		if err := json.Unmarshal([]byte(msg.Payload), &redisMessage); err != nil {
+// replayMissedEvents queues the conversation events published after lastEventId up to untilId,
+// the last event this instance delivered live when the client joined, then the live events
+// held back for the client meanwhile. A replay cut short by the limit or an error ends with
+// a replay_truncated event carrying the last replayed ID. It must be called without sch.mu held.
+func (sch *SocketChatHandler) replayMissedEvents(client *models.SocketClient, conversationId uint, lastEventId, untilId string) {
+	messages, err := sch.broker.Replay(redisModels.ChatConversationChannel(conversationId), lastEventId, untilId, sch.maxReplayCount)
+	truncated := err != nil
+	if err != nil {
+		log.Printf("replayMissedEvents / Error replaying chat events after %v: %v", lastEventId, err)
+	}
+	if int64(len(messages)) == sch.maxReplayCount && messages[len(messages)-1].ID != untilId {
+		truncated = true
+		log.Printf("replayMissedEvents / replay of user %v reached the limit of %v events", client.UserId, sch.maxReplayCount)
+	}
+	lastReplayedId := lastEventId
+	for _, message := range messages {
+		lastReplayedId = message.ID
+		redisMessage, err := sch.decodeBrokerMessage(message)
+		if err != nil {
 			log.Printf("Error unmarshalling message: %v", err)
 			continue
 		}
+		if client.SendOnChannel(enums.SOCKET_CHANNEL_CHAT, redisMessage) {
+			sch.handleDelivery(redisMessage, []uint{client.UserId})
+		}
+	}
+	// Events after the last replayed one are missing, the client refetches them over REST
+	if truncated {
+		client.SendOnChannel(enums.SOCKET_CHANNEL_CHAT, redisModels.RedisPublishedMessage{
+			EventID:        lastReplayedId,
+			Event:          enums.SOCKET_EVENT_REPLAY_TRUNCATED,
+			ConversationID: conversationId,
+		})
+	}
+
+	key := chatReplayKey{client: client, conversationId: conversationId}
+	var delivered []redisModels.RedisPublishedMessage
+	sch.mu.Lock()
+	// Clients that left during the replay have nothing held back
+	for _, redisMessage := range sch.replaying[key] {
+		if client.SendOnChannel(enums.SOCKET_CHANNEL_CHAT, redisMessage) {
+			delivered = append(delivered, redisMessage)
+		}
+	}
+	delete(sch.replaying, key)
+	sch.mu.Unlock()
+
+	for _, redisMessage := range delivered {
+		sch.handleDelivery(redisMessage, []uint{client.UserId})
+	}
+}
+
+// subscribeToConversation starts receiving the conversation events published after lastId from the broker.
+// It must be called with sch.mu held, when the first client of the conversation joins.
+func (sch *SocketChatHandler) subscribeToConversation(conversationId uint, lastId string) error {
+	// Subscribe right after lastId so nothing published since it was read is missed
+	err := sch.broker.Subscribe(redisModels.ChatConversationChannel(conversationId), lastId, func(message *models.BrokerMessage) {
+		redisMessage, err := sch.decodeBrokerMessage(message)
+		if err != nil {
+			log.Printf("Error unmarshalling message: %v", err)
+			return
+		}
 		sch.SendMessageToClient(redisMessage)
+	})
+	if err != nil {
+		return err
+	}
+	sch.lastEventIds[conversationId] = lastId
+	return nil
+}
+
+// unsubscribeFromConversation stops receiving the conversation events from the broker.
+// It must be called with sch.mu held, when the last client of the conversation leaves.
+func (sch *SocketChatHandler) unsubscribeFromConversation(conversationId uint) {
+	delete(sch.lastEventIds, conversationId)
+	if err := sch.broker.Unsubscribe(redisModels.ChatConversationChannel(conversationId)); err != nil {
+		log.Printf("unsubscribeFromConversation / Could not unsubscribe from conversation %v: %v", conversationId, err)
+	}
+}
+
+func (sch *SocketChatHandler) decodeBrokerMessage(message *models.BrokerMessage) (redisModels.RedisPublishedMessage, error) {
+	var redisMessage redisModels.RedisPublishedMessage
+	if err := json.Unmarshal(message.Payload, &redisMessage); err != nil {
+		return redisMessage, err
 	}
+	redisMessage.EventID = message.ID
+	return redisMessage, nil
 }
 
 func (sch *SocketChatHandler) SendMessageToClient(redisMessage redisModels.RedisPublishedMessage) {
 	sch.mu.Lock()
-	defer sch.mu.Unlock()
+	// Ignore events of conversations no longer hosted here and events already replayed or delivered
+	lastEventId, subscribed := sch.lastEventIds[redisMessage.ConversationID]
+	if !subscribed || utils.CompareMessageIds(redisMessage.EventID, lastEventId) <= 0 {
+		sch.mu.Unlock()
+		return
+	}
+	sch.lastEventIds[redisMessage.ConversationID] = redisMessage.EventID
+	var recipientIds []uint
 	if conversation, ok := sch.hub.Conversations[redisMessage.ConversationID]; ok {
 		for _, client := range conversation {
-			if err := client.Conn.WriteJSON(redisMessage); err != nil {
-				log.Printf("Error writing json: %v", err)
-				err := client.Conn.Close()
-				if err != nil {
-					return
-				}
-				sch.deleteDiconnectedClientFromConversation(client.UserId, redisMessage.ConversationID)
+			key := chatReplayKey{client: client, conversationId: redisMessage.ConversationID}
+			if heldBack, replaying := sch.replaying[key]; replaying {
+				sch.replaying[key] = append(heldBack, redisMessage)
+				continue
+			}
+			// Clients that can't take the event are closed by their own pump,
+			// their read loop then removes them from the conversation
+			if !client.SendOnChannel(enums.SOCKET_CHANNEL_CHAT, redisMessage) {
+				log.Printf("SendMessageToClient / event dropped for user %v in conversation %v", client.UserId, redisMessage.ConversationID)
+				continue
+			}
+			if !slices.Contains(recipientIds, client.UserId) {
+				recipientIds = append(recipientIds, client.UserId)
+			}
+		}
+	}
+	sch.mu.Unlock()
+
+	sch.handleDelivery(redisMessage, recipientIds)
+}
+
+// handleDelivery records in the background that a new message reached the given users,
+// each instance records the deliveries to its own clients
+func (sch *SocketChatHandler) handleDelivery(redisMessage redisModels.RedisPublishedMessage, recipientIds []uint) {
+	if redisMessage.Event != enums.SOCKET_EVENT_SEND_MESSAGE || len(recipientIds) == 0 {
+		return
+	}
+	// The payload comes back from the broker as generic JSON
+	jsonPayload, err := json.Marshal(redisMessage.Payload)
+	if err != nil {
+		log.Printf("handleDelivery / Error encoding message payload: %v", err)
+		return
+	}
+	var message models.Message
+	if err := json.Unmarshal(jsonPayload, &message); err != nil || message.ID == 0 {
+		log.Printf("handleDelivery / Event %v carries no message: %v", redisMessage.EventID, err)
+		return
+	}
+	go func() {
+		for _, recipientId := range recipientIds {
+			if errs := sch.RecordDeliveries([]uint{message.ID}, recipientId); len(errs) > 0 {
+				log.Printf("handleDelivery / Error recording delivery of message %v to user %v: %v", message.ID, recipientId, errs)
 			}
 		}
+	}()
+}
+
+// RecordDeliveries records that the messages reached the recipient
+// and lets the senders know through a message_delivered event per new delivery
+func (sch *SocketChatHandler) RecordDeliveries(messageIds []uint, recipientId uint) []error {
+	var errors []error
+	deliveries, deliveryErrs := sch.chatService.RecordDeliveries(messageIds, recipientId)
+	if len(deliveryErrs) > 0 {
+		errors = append(errors, deliveryErrs...)
+		return errors
+	}
+	for _, delivery := range deliveries {
+		deliveredPayload := socketModels.MessageDeliveredPayload{
+			MessageID:      delivery.MessageID,
+			ConversationID: delivery.Message.ConversationID,
+			SenderID:       delivery.Message.SenderID,
+			UserID:         delivery.UserID,
+			DeliveredAt:    delivery.DeliveredAt,
+		}
+		if err := sch.PublishEvent(enums.SOCKET_EVENT_MESSAGE_DELIVERED, deliveredPayload.ConversationID, deliveredPayload); err != nil {
+			errors = append(errors, err)
+		}
+	}
+	return errors
+}
+
+func (sch *SocketChatHandler) isSubscribed(client *models.SocketClient, conversationId uint) bool {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	return slices.Contains(sch.hub.Conversations[conversationId], client)
+}
+
+// Connect is a no-op, clients of the multiplexed socket join conversations through Subscribe
+func (sch *SocketChatHandler) Connect(client *models.SocketClient) {}
+
+// Disconnect removes the client from every conversation it joined
+func (sch *SocketChatHandler) Disconnect(client *models.SocketClient) {
+	var conversationIds []uint
+	sch.mu.Lock()
+	for conversationId, clients := range sch.hub.Conversations {
+		if slices.Contains(clients, client) {
+			conversationIds = append(conversationIds, conversationId)
+		}
+	}
+	sch.mu.Unlock()
+	for _, conversationId := range conversationIds {
+		sch.deleteDiconnectedClientFromConversation(client, conversationId)
+	}
+}
+
+func (sch *SocketChatHandler) Subscribe(client *models.SocketClient, conversationId uint, payload json.RawMessage) error {
+	var subscribePayload socketModels.SubscribePayload
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &subscribePayload); err != nil {
+			return errs.ErrInvalidRequest
+		}
+	}
+	if !sch.chatService.CheckConversationExists(conversationId) {
+		return errs.ErrInvalidConversationId
+	}
+	// Check if user is part of the conversation
+	if !sch.chatService.CheckUserInConversation(client.UserId, conversationId) {
+		return errs.ErrInvalidConversationId
 	}
+	return sch.handleConversationAndClinet(client, conversationId, subscribePayload.LastEventID)
 }
 
-func (sch *SocketChatHandler) PublishMessage(redis *redis.Client, channel string, message []byte) error {
-	return redis.Publish(sch.ctx, channel, message).Err()
+func (sch *SocketChatHandler) Unsubscribe(client *models.SocketClient, conversationId uint) {
+	sch.deleteDiconnectedClientFromConversation(client, conversationId)
 }
 
-func (sch *SocketChatHandler) SubscribeToChannel(redis *redis.Client, channel string) <-chan *redis.Message {
-	pubsub := redis.Subscribe(sch.ctx, channel)
-	_, err := pubsub.Receive(sch.ctx)
+func (sch *SocketChatHandler) HandleEvent(client *models.SocketClient, userInfo *models.Claims, conversationId uint, event string, payload json.RawMessage) (any, []error) {
+	if !sch.isSubscribed(client, conversationId) {
+		return nil, []error{errs.ErrNotSubscribed}
+	}
+	return sch.handleEvent(userInfo, conversationId, event, payload)
+}
+
+func (sch *SocketChatHandler) PublishMessage(channel string, message []byte) error {
+	_, err := sch.broker.Publish(channel, message)
+	return err
+}
+
+// PublishEvent broadcasts an event to every member of the conversation connected to any instance.
+// Events carrying a thread reply are marked with its thread.
+func (sch *SocketChatHandler) PublishEvent(event string, conversationId uint, payload any) error {
+	redisEvent := redisModels.RedisPublishedMessage{
+		Event:          event,
+		ConversationID: conversationId,
+		Payload:        payload,
+	}
+	if message, ok := payload.(*models.Message); ok {
+		redisEvent.ThreadRootID = message.ThreadRootID
+	}
+	jsonEvent, err := json.Marshal(redisEvent)
 	if err != nil {
-		log.Fatalf("Could not subscribe to channel: %v", err)
+		return err
 	}
-	return pubsub.Channel()
+	return sch.PublishMessage(redisModels.ChatConversationChannel(conversationId), jsonEvent)
 }
 
 func (sch *SocketChatHandler) WaitForShutdown(httpServer *http.Server) {
@@ -421,10 +843,7 @@ func (sch *SocketChatHandler) WaitForShutdown(httpServer *http.Server) {
 	sch.mu.Lock()
 	for conversationId, clients := range sch.hub.Conversations {
 		for _, client := range clients {
-			err := client.Conn.Close()
-			if err != nil {
-				return
-			}
+			client.Close()
 		}
 		delete(sch.hub.Conversations, conversationId)
 	}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"socketChat/internal/enums"
+	"socketChat/internal/errs"
+	socketModels "socketChat/internal/models/socket"
+)
+
+// isMalformedMessageError reports whether a read error was caused by a bad payload
+// rather than a broken connection, so the read loop can keep going.
+// Any other error means the connection is gone and further reads would fail as well.
+func isMalformedMessageError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
+}
+
+// newSocketAck builds the answer to an event that carried a request ID,
+// an error frame if handling the event failed and an ack frame otherwise
+func newSocketAck(requestId, event string, data any, eventErrs []error) socketModels.SocketAck {
+	if len(eventErrs) == 0 {
+		return socketModels.SocketAck{
+			Type:      enums.SOCKET_EVENT_ACK,
+			RequestID: requestId,
+			Event:     event,
+			Data:      data,
+		}
+	}
+	ack := socketModels.SocketAck{
+		Type:      enums.SOCKET_EVENT_ERROR,
+		RequestID: requestId,
+		Event:     event,
+		Code:      errs.Code(eventErrs[0]),
+	}
+	for _, err := range eventErrs {
+		// Only errors of the errs package are meant for clients
+		if errs.Code(err) == errs.ErrCodeInternal {
+			ack.Errors = append(ack.Errors, errs.ErrCodeInternal)
+			continue
+		}
+		ack.Errors = append(ack.Errors, err.Error())
+	}
+	return ack
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"socketChat/internal/enums"
+	"socketChat/internal/errs"
+	"socketChat/internal/interfaces"
+	"socketChat/internal/models"
+	socketModels "socketChat/internal/models/socket"
+	"socketChat/internal/msgs"
+	"socketChat/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// SocketRouterHandler serves a single authenticated socket per user and routes
+// its frames to the chat, observing and whiteboard topics by channel
+type SocketRouterHandler struct {
+	ctx           context.Context
+	upgrader      websocket.Upgrader
+	topics        map[string]interfaces.SocketTopic
+	clientOptions *models.SocketClientOptions
+}
+
+func NewSocketRouterHandler(
+	ctx context.Context,
+	socketChatHandler *SocketChatHandler,
+	socketUserObservingHandler *SocketUserObservingHandler,
+	socketWhiteboardHandler *SocketWhiteboardHandler,
+	clientOptions *models.SocketClientOptions,
+) *SocketRouterHandler {
+	return &SocketRouterHandler{
+		ctx:           ctx,
+		clientOptions: clientOptions,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				return true
+			},
+		},
+		topics: map[string]interfaces.SocketTopic{
+			enums.SOCKET_CHANNEL_CHAT:       socketChatHandler,
+			enums.SOCKET_CHANNEL_OBSERVE:    socketUserObservingHandler,
+			enums.SOCKET_CHANNEL_WHITEBOARD: socketWhiteboardHandler,
+		},
+	}
+}
+
+func (srh *SocketRouterHandler) HandleSocketRoute(ctx *gin.Context) {
+	// Authenticate user
+	userInfo, err := srh.authorize(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+			Success: false,
+			Message: msgs.MsgOperationFailed,
+			Errors:  []error{errs.ErrUnauthorized},
+		})
+		return
+	}
+
+	ws, err := srh.upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade connection: %v", err)
+		return
+	}
+
+	client := models.NewMultiplexedSocketClient(ws, userInfo.ID, srh.clientOptions)
+	defer client.Close()
+
+	// Start delivering outbound events to the client
+	go client.WritePump()
+
+	for _, topic := range srh.topics {
+		topic.Connect(client)
+	}
+	defer func() {
+		for _, topic := range srh.topics {
+			topic.Disconnect(client)
+		}
+	}()
+
+	srh.handleIncommingEvents(client, userInfo)
+}
+
+func (srh *SocketRouterHandler) authorize(ctx *gin.Context) (*models.Claims, error) {
+	jwtToken := ctx.Request.Header.Get("Authorization")
+	if jwtToken == "" {
+		return nil, errs.ErrUnauthorized
+	}
+	userInfo, err := utils.VerifyToken(jwtToken)
+	if err != nil {
+		return nil, err
+	}
+	if userInfo.ID == 0 {
+		return nil, errs.ErrUnauthorized
+	}
+	return userInfo, nil
+}
+
+func (srh *SocketRouterHandler) handleIncommingEvents(client *models.SocketClient, userInfo *models.Claims) {
+	for {
+		var event socketModels.MultiplexedSocketEvent
+		err := client.Conn.ReadJSON(&event)
+		if err != nil {
+			if isMalformedMessageError(err) {
+				log.Printf("SocketRouterHandler / handleIncommingEvents / Error reading json: %v", err)
+				continue
+			}
+			log.Printf("SocketRouterHandler / handleIncommingEvents / connection closed - Error: %v", err)
+			break
+		}
+
+		entity, errs := srh.handleEvent(client, userInfo, event)
+		if len(errs) > 0 {
+			log.Printf("SocketRouterHandler / handleIncommingEvents / Error while handling %v event on %v channel: %v", event.Event, event.Channel, errs)
+		}
+		if event.RequestID != "" {
+			client.SendOnChannel(event.Channel, newSocketAck(event.RequestID, event.Event, entity, errs))
+		}
+	}
+}
+
+func (srh *SocketRouterHandler) handleEvent(client *models.SocketClient, userInfo *models.Claims, event socketModels.MultiplexedSocketEvent) (any, []error) {
+	topic, ok := srh.topics[event.Channel]
+	if !ok {
+		return nil, []error{errs.ErrUnknownSocketChannel}
+	}
+	if event.ID == 0 {
+		return nil, []error{errs.ErrInvalidRequest}
+	}
+
+	switch event.Event {
+	case enums.SOCKET_EVENT_SUBSCRIBE:
+		if err := topic.Subscribe(client, event.ID, event.Payload); err != nil {
+			return nil, []error{err}
+		}
+		return nil, nil
+	case enums.SOCKET_EVENT_UNSUBSCRIBE:
+		topic.Unsubscribe(client, event.ID)
+		return nil, nil
+	default:
+		return topic.HandleEvent(client, userInfo, event.ID, event.Event, event.Payload)
+	}
+}
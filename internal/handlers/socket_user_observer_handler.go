@@ -10,6 +10,7 @@ import (
 	"slices"
 	"socketChat/internal/enums"
 	"socketChat/internal/errs"
+	"socketChat/internal/interfaces"
 	"socketChat/internal/models"
 	redisModels "socketChat/internal/models/redis"
 	obsSocketModels "socketChat/internal/models/socket/observing"
@@ -27,28 +28,42 @@ import (
 )
 
 type SocketUserObservingHandler struct {
-	mu          sync.Mutex
-	ctx         context.Context
-	upgrader    websocket.Upgrader
-	hub         *obsSocketModels.SocketUserObservingHub
-	authService *services.AuthenticationService
+	mu            sync.Mutex
+	ctx           context.Context
+	upgrader      websocket.Upgrader
+	hub           *obsSocketModels.SocketUserObservingHub
+	authService   *services.AuthenticationService
+	broker        interfaces.Broker
+	clientOptions *models.SocketClientOptions
+
+	brokerMu sync.Mutex
+	// Whether the presence channel of the broker is subscribed to
+	brokerSubscribed bool
 }
 
+// NewSocketUserObservingHandler creates the presence handler.
+// redis is only used to cache online statuses and may be nil.
 func NewSocketUserObservingHandler(
 	redis *redis.Client,
+	broker interfaces.Broker,
 	ctx context.Context,
 	authService *services.AuthenticationService,
+	clientOptions *models.SocketClientOptions,
 ) *SocketUserObservingHandler {
 	suoh := &SocketUserObservingHandler{
-		ctx:         ctx,
-		authService: authService,
+		ctx:           ctx,
+		authService:   authService,
+		broker:        broker,
+		clientOptions: clientOptions,
 		hub: &obsSocketModels.SocketUserObservingHub{
 			Notifiers: make(map[uint][]*models.SocketClient),
 			Mu:        sync.Mutex{},
 			Redis:     redis,
 		},
 	}
-	go suoh.handleRedisMessages()
+	if err := suoh.handleBrokerMessages(); err != nil {
+		log.Printf("NewSocketUserObservingHandler / Could not subscribe to channel, retrying on the next subscription: %v", err)
+	}
 	return suoh
 }
 
@@ -74,12 +89,11 @@ func (suoh *SocketUserObservingHandler) HandleSocketUserObservingRoute(ctx *gin.
 		})
 		return
 	}
-	defer func(ws *websocket.Conn) {
-		err := ws.Close()
-		if err != nil {
-			log.Printf("Error closing connection: %v", err)
-		}
-	}(ws)
+	observer := models.NewSocketClient(ws, userInfo.ID, suoh.clientOptions)
+	defer observer.Close()
+
+	// Start delivering notifications to the observer
+	go observer.WritePump()
 
 	// Set the user online status to online
 	suoh.setOnlineStatus(userInfo.ID, true)
@@ -87,11 +101,13 @@ func (suoh *SocketUserObservingHandler) HandleSocketUserObservingRoute(ctx *gin.
 	// Subscribe to notifiers
 	notifiers, err := suoh.retrieveNotifiersFromQuery(ctx)
 	if err == nil && len(notifiers) > 0 {
-		suoh.handleSubscription(ws, userInfo, notifiers)
+		if err := suoh.handleSubscription(observer, notifiers); err != nil {
+			log.Printf("SocketUserObservingHandler / HandleSocketUserObservingRoute / Could not subscribe observer %v: %v", observer.UserId, err)
+		}
 	}
 
 	// Keep socket alive to notify user
-	suoh.keepSocketAlive(ws, userInfo.ID)
+	suoh.keepSocketAlive(observer)
 }
 
 func (souh *SocketUserObservingHandler) authorize(ctx *gin.Context) (*models.Claims, error) {
@@ -107,22 +123,18 @@ func (souh *SocketUserObservingHandler) authorize(ctx *gin.Context) (*models.Cla
 	return userInfo, nil
 }
 
-func (suoh *SocketUserObservingHandler) keepSocketAlive(ws *websocket.Conn, userId uint) {
+func (suoh *SocketUserObservingHandler) keepSocketAlive(observer *models.SocketClient) {
 	for {
 		var buf bytes.Buffer
-		err := ws.ReadJSON(&buf)
+		err := observer.Conn.ReadJSON(&buf)
 		if err != nil {
-			if websocket.IsCloseError(err,
-				websocket.CloseAbnormalClosure,
-				websocket.CloseNormalClosure,
-				websocket.CloseNoStatusReceived,
-			) {
-				log.Printf("SocketUserObservingHandler / keepSocketAlive / connection closed by client side - Error: %v", err)
-				suoh.unsubscribe(userId)
-				break
+			if isMalformedMessageError(err) {
+				log.Printf("Error reading json from user %v: %v", observer.UserId, err)
+				continue
 			}
-			log.Printf("Error reading json from user %v: %v", userId, err)
-			continue
+			log.Printf("SocketUserObservingHandler / keepSocketAlive / connection closed - Error: %v", err)
+			suoh.unsubscribe(observer.UserId)
+			break
 		}
 		log.Println("keepSocketAlive buf: ", buf.String())
 	}
@@ -171,13 +183,16 @@ func (suoh *SocketUserObservingHandler) setOnlineStatus(userId uint, status bool
 		return
 	}
 	log.Println("setOnlineStatus jsonEvent: ", string(jsonEvent))
-	if err := suoh.publish(suoh.hub.Redis, redisModels.REDIS_CHANNEL_OBSERVE, jsonEvent); err != nil {
+	if err := suoh.publish(redisModels.REDIS_CHANNEL_OBSERVE, jsonEvent); err != nil {
 		log.Println("failed to publish message: ", err)
 		return
 	}
 }
 
 func (suoh *SocketUserObservingHandler) updateUserOnlineStatusInCache(userID uint, status bool, lastSeen time.Time) error {
+	if suoh.hub.Redis == nil {
+		return errs.ErrCacheNotConfigured
+	}
 	expirationDuration := time.Duration(time.Hour * 24)
 
 	// Save online status
@@ -204,6 +219,9 @@ func (suoh *SocketUserObservingHandler) updateUserOnlineStatusInCache(userID uin
 }
 
 func (suoh *SocketUserObservingHandler) fetchUserOnlineStatusFromCache(userID uint) (bool, *time.Time, error) {
+	if suoh.hub.Redis == nil {
+		return false, nil, errs.ErrCacheNotConfigured
+	}
 	// Get online status
 	statusKey := fmt.Sprintf("user_online_status_%v", userID)
 	statusStr, err := suoh.hub.Redis.Get(suoh.ctx, statusKey).Result()
@@ -262,13 +280,9 @@ func (suoh *SocketUserObservingHandler) upgradeHttpToWs(ctx *gin.Context) (*webs
 	return ws, nil
 }
 
-func (suoh *SocketUserObservingHandler) handleSubscription(ws *websocket.Conn, userInfo *models.Claims, notifiers []uint) {
-	observer := &models.SocketClient{
-		Conn:   ws,
-		UserId: userInfo.ID,
-	}
-	suoh.subscribe(observer, notifiers)
+func (suoh *SocketUserObservingHandler) handleSubscription(observer *models.SocketClient, notifiers []uint) error {
 	suoh.handleDisconnection(observer)
+	return suoh.subscribe(observer, notifiers)
 }
 
 func (suoh *SocketUserObservingHandler) handleDisconnection(observer *models.SocketClient) {
@@ -278,7 +292,10 @@ func (suoh *SocketUserObservingHandler) handleDisconnection(observer *models.Soc
 	})
 }
 
-func (suoh *SocketUserObservingHandler) subscribe(observer *models.SocketClient, notifiersToObserve []uint) {
+func (suoh *SocketUserObservingHandler) subscribe(observer *models.SocketClient, notifiersToObserve []uint) error {
+	if err := suoh.handleBrokerMessages(); err != nil {
+		return err
+	}
 	suoh.mu.Lock()
 	defer suoh.mu.Unlock()
 	for _, notifier := range notifiersToObserve {
@@ -287,16 +304,19 @@ func (suoh *SocketUserObservingHandler) subscribe(observer *models.SocketClient,
 			suoh.hub.Notifiers[notifier] = []*models.SocketClient{}
 		}
 		// Add observer to notifier if not observing yet and save it in redis cache
-		if observing := slices.Contains(suoh.hub.Notifiers[notifier],
-			&models.SocketClient{Conn: observer.Conn, UserId: observer.UserId}); !observing {
+		if observing := slices.Contains(suoh.hub.Notifiers[notifier], observer); !observing {
 			err := suoh.saveObserverNotifiersInCache(observer.UserId, notifier)
 			if err != nil {
-				log.Fatalf("Could not add the notifier to observer notifiers in cache: %v", err)
-				return
+				log.Printf("Could not add the notifier to observer notifiers in cache: %v", err)
+				if len(suoh.hub.Notifiers[notifier]) == 0 {
+					delete(suoh.hub.Notifiers, notifier)
+				}
+				return err
 			}
 			suoh.hub.Notifiers[notifier] = append(suoh.hub.Notifiers[notifier], observer)
 		}
 	}
+	return nil
 }
 
 func (suoh *SocketUserObservingHandler) unsubscribe(observer uint) {
@@ -315,10 +335,12 @@ func (suoh *SocketUserObservingHandler) unsubscribe(observer uint) {
 	log.Printf("unsubscribe - fetchObserverNotifiersFromCache for observer %v: %v", observer, notifiers)
 
 	// Remove observer from redis cache
-	err = suoh.hub.Redis.Del(suoh.ctx, fmt.Sprintf("observer_notifiers_%d", observer)).Err()
-	if err != nil {
-		log.Printf("Could not remove observer from redis cache: %v", err)
-		return
+	if suoh.hub.Redis != nil {
+		err = suoh.hub.Redis.Del(suoh.ctx, fmt.Sprintf("observer_notifiers_%d", observer)).Err()
+		if err != nil {
+			log.Printf("Could not remove observer from redis cache: %v", err)
+			return
+		}
 	}
 
 	suoh.mu.Lock()
@@ -338,7 +360,41 @@ func (suoh *SocketUserObservingHandler) unsubscribe(observer uint) {
 	suoh.mu.Unlock()
 }
 
+// observerNotifiersFromHub lists the notifiers observed by any connection of the observer
+func (suoh *SocketUserObservingHandler) observerNotifiersFromHub(observer uint) []uint {
+	suoh.mu.Lock()
+	defer suoh.mu.Unlock()
+	var notifiers []uint
+	for notifier, observers := range suoh.hub.Notifiers {
+		for _, client := range observers {
+			if client.UserId == observer {
+				notifiers = append(notifiers, notifier)
+				break
+			}
+		}
+	}
+	return notifiers
+}
+
+func (suoh *SocketUserObservingHandler) removeObserverFromNotifier(observer *models.SocketClient, notifier uint) {
+	suoh.mu.Lock()
+	defer suoh.mu.Unlock()
+	for i, client := range suoh.hub.Notifiers[notifier] {
+		if client == observer {
+			suoh.hub.Notifiers[notifier] = append(suoh.hub.Notifiers[notifier][:i], suoh.hub.Notifiers[notifier][i+1:]...)
+			break
+		}
+	}
+	// Check if the notifier observers is empty and remove it from the hub
+	if len(suoh.hub.Notifiers[notifier]) == 0 {
+		delete(suoh.hub.Notifiers, notifier)
+	}
+}
+
 func (suoh *SocketUserObservingHandler) saveObserverNotifiersInCache(observer uint, notifier uint) error {
+	if suoh.hub.Redis == nil {
+		return nil
+	}
 	key := fmt.Sprintf("observer_notifiers_%d", observer)
 	err := suoh.hub.Redis.RPush(suoh.ctx, key, fmt.Sprintf("%d", notifier)).Err()
 	if err != nil {
@@ -348,6 +404,9 @@ func (suoh *SocketUserObservingHandler) saveObserverNotifiersInCache(observer ui
 }
 
 func (souh *SocketUserObservingHandler) fetchObserverNotifiersFromCache(observer uint) ([]uint, error) {
+	if souh.hub.Redis == nil {
+		return souh.observerNotifiersFromHub(observer), nil
+	}
 	key := fmt.Sprintf("observer_notifiers_%d", observer)
 	value, err := souh.hub.Redis.LRange(souh.ctx, key, 0, -1).Result()
 	if err != nil {
@@ -364,17 +423,70 @@ func (souh *SocketUserObservingHandler) fetchObserverNotifiersFromCache(observer
 	return notifiers, nil
 }
 
-func (suoh *SocketUserObservingHandler) handleRedisMessages() {
-	ch := suoh.subscribeToChannel(suoh.hub.Redis, redisModels.REDIS_CHANNEL_OBSERVE)
-	for msg := range ch {
+// Connect marks the user of a multiplexed socket as online
+func (suoh *SocketUserObservingHandler) Connect(client *models.SocketClient) {
+	suoh.setOnlineStatus(client.UserId, true)
+}
+
+// Disconnect stops every observation of the client and marks its user as offline
+func (suoh *SocketUserObservingHandler) Disconnect(client *models.SocketClient) {
+	var notifiers []uint
+	suoh.mu.Lock()
+	for notifier, observers := range suoh.hub.Notifiers {
+		if slices.Contains(observers, client) {
+			notifiers = append(notifiers, notifier)
+		}
+	}
+	suoh.mu.Unlock()
+	for _, notifier := range notifiers {
+		suoh.Unsubscribe(client, notifier)
+	}
+	suoh.setOnlineStatus(client.UserId, false)
+}
+
+func (suoh *SocketUserObservingHandler) Subscribe(client *models.SocketClient, notifier uint, payload json.RawMessage) error {
+	return suoh.subscribe(client, []uint{notifier})
+}
+
+func (suoh *SocketUserObservingHandler) Unsubscribe(client *models.SocketClient, notifier uint) {
+	suoh.removeObserverFromNotifier(client, notifier)
+	if suoh.hub.Redis == nil {
+		return
+	}
+	key := fmt.Sprintf("observer_notifiers_%d", client.UserId)
+	if err := suoh.hub.Redis.LRem(suoh.ctx, key, 1, fmt.Sprintf("%d", notifier)).Err(); err != nil {
+		log.Printf("Could not remove notifier %v from observer %v notifiers in cache: %v", notifier, client.UserId, err)
+	}
+}
+
+// HandleEvent rejects every event, observers only receive notifications
+func (suoh *SocketUserObservingHandler) HandleEvent(client *models.SocketClient, userInfo *models.Claims, notifier uint, event string, payload json.RawMessage) (any, []error) {
+	return nil, []error{errs.ErrUnknownSocketEvent}
+}
+
+// handleBrokerMessages subscribes to the presence channel of the broker once.
+// A failed attempt is retried by the next subscription of an observer.
+func (suoh *SocketUserObservingHandler) handleBrokerMessages() error {
+	suoh.brokerMu.Lock()
+	defer suoh.brokerMu.Unlock()
+	if suoh.brokerSubscribed {
+		return nil
+	}
+	log.Printf("Subscribing to broker channel %v", redisModels.REDIS_CHANNEL_OBSERVE)
+	err := suoh.broker.Subscribe(redisModels.REDIS_CHANNEL_OBSERVE, "", func(message *models.BrokerMessage) {
 		var redisMessage obsSocketModels.ObservingSocketEvent
-		if err := json.Unmarshal([]byte(msg.Payload), &redisMessage); err != nil {
+		if err := json.Unmarshal(message.Payload, &redisMessage); err != nil {
 			log.Printf("Error unmarshalling message: %v", err)
-			continue
+			return
 		}
-		log.Println("handleRedisMessages New redis message received")
+		log.Println("handleBrokerMessages New broker message received")
 		suoh.send(redisMessage)
+	})
+	if err != nil {
+		return err
 	}
+	suoh.brokerSubscribed = true
+	return nil
 }
 
 func (suoh *SocketUserObservingHandler) send(redisMessage obsSocketModels.ObservingSocketEvent) {
@@ -386,13 +498,10 @@ func (suoh *SocketUserObservingHandler) send(redisMessage obsSocketModels.Observ
 		if len(notifier) > 0 {
 			for _, client := range notifier {
 				log.Printf("Found observer %v", client.UserId)
-				if err := client.Conn.WriteJSON(redisMessage); err != nil {
-					log.Printf("Error writing json: %v", err)
-					err := client.Conn.Close()
-					if err != nil {
-						return
-					}
-					suoh.unsubscribe(client.UserId)
+				// Observers that can't take the event are closed by their own pump,
+				// their read loop then unsubscribes them
+				if !client.SendOnChannel(enums.SOCKET_CHANNEL_OBSERVE, redisMessage) {
+					log.Printf("send / event dropped for observer %v", client.UserId)
 				}
 			}
 		} else {
@@ -403,17 +512,8 @@ func (suoh *SocketUserObservingHandler) send(redisMessage obsSocketModels.Observ
 	}
 }
 
-func (suoh *SocketUserObservingHandler) publish(redis *redis.Client, channel string, message []byte) error {
+func (suoh *SocketUserObservingHandler) publish(channel string, message []byte) error {
 	log.Printf("Publishing message to channel %v with message %v", channel, string(message))
-	return redis.Publish(suoh.ctx, channel, message).Err()
-}
-
-func (suoh *SocketUserObservingHandler) subscribeToChannel(redis *redis.Client, channel string) <-chan *redis.Message {
-	log.Printf("Subscribing to redis channel %v", channel)
-	pubsub := redis.Subscribe(suoh.ctx, channel)
-	_, err := pubsub.Receive(suoh.ctx)
-	if err != nil {
-		log.Fatalf("Could not subscribe to channel: %v", err)
-	}
-	return pubsub.Channel()
+	_, err := suoh.broker.Publish(channel, message)
+	return err
 }
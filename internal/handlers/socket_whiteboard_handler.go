@@ -10,6 +10,7 @@ import (
 	"slices"
 	"socketChat/internal/enums"
 	"socketChat/internal/errs"
+	"socketChat/internal/interfaces"
 	"socketChat/internal/models"
 	redisModels "socketChat/internal/models/redis"
 	"socketChat/internal/msgs"
@@ -21,7 +22,6 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
-	"github.com/redis/go-redis/v9"
 )
 
 type SocketWhiteboardHandler struct {
@@ -29,21 +29,28 @@ type SocketWhiteboardHandler struct {
 	ctx               context.Context
 	upgrader          websocket.Upgrader
 	hub               *models.SocketWhiteboardHub
-	Redis             *redis.Client
+	broker            interfaces.Broker
 	whiteboardService *services.WhiteboardService
+	clientOptions     *models.SocketClientOptions
 }
 
-func NewSocketWhiteboardHandler(redis *redis.Client, ctx context.Context, whiteboardService *services.WhiteboardService) *SocketWhiteboardHandler {
+func NewSocketWhiteboardHandler(
+	broker interfaces.Broker,
+	ctx context.Context,
+	whiteboardService *services.WhiteboardService,
+	clientOptions *models.SocketClientOptions,
+) *SocketWhiteboardHandler {
 	swh := &SocketWhiteboardHandler{
 		ctx:               ctx,
 		whiteboardService: whiteboardService,
+		clientOptions:     clientOptions,
 		mu:                sync.Mutex{},
-		Redis:             redis,
+		broker:            broker,
 		hub: &models.SocketWhiteboardHub{
 			Whiteboards: make(map[uint][]*models.SocketClient),
 		},
 	}
-	go swh.handleRedisMessages()
+	swh.handleBrokerMessages()
 	return swh
 }
 
@@ -124,80 +131,76 @@ func (swh *SocketWhiteboardHandler) handleConnection(ctx *gin.Context, userInfo
 		})
 		return
 	}
-	defer func(ws *websocket.Conn) {
-		err := ws.Close()
-		if err != nil {
-			log.Printf("Error closing connection: %v", err)
-		}
-	}(ws)
+	client := models.NewSocketClient(ws, userInfo.ID, swh.clientOptions)
+	defer client.Close()
+
+	// Start delivering whiteboard events to the client
+	go client.WritePump()
 
-	swh.handleDiconnectedClient(ws, userInfo.ID, whiteboardId)
+	swh.handleDiconnectedClient(client, whiteboardId)
 
 	// Add client to hub
-	swh.handleWhiteboardAndClinet(userInfo.ID, whiteboardId, ws)
+	swh.handleWhiteboardAndClinet(client, whiteboardId)
 
-	swh.handleIncommingWhiteboardEvent(ws, userInfo, whiteboardId)
+	swh.handleIncommingWhiteboardEvent(client, whiteboardId)
 }
 
-func (swh *SocketWhiteboardHandler) handleDiconnectedClient(ws *websocket.Conn, userId uint, whiteboardId uint) {
-	ws.SetCloseHandler(func(code int, text string) error {
-		swh.deleteDiconnectedClientFromWhiteboard(userId, whiteboardId)
+func (swh *SocketWhiteboardHandler) handleDiconnectedClient(client *models.SocketClient, whiteboardId uint) {
+	client.Conn.SetCloseHandler(func(code int, text string) error {
+		swh.deleteDiconnectedClientFromWhiteboard(client, whiteboardId)
 		return nil
 	})
 }
 
-func (swh *SocketWhiteboardHandler) handleWhiteboardAndClinet(userId uint, whiteboardId uint, ws *websocket.Conn) {
-	log.Printf("handleWhiteboardAndClinet / user: %v - whiteboard: %v", userId, whiteboardId)
+func (swh *SocketWhiteboardHandler) handleWhiteboardAndClinet(client *models.SocketClient, whiteboardId uint) {
+	log.Printf("handleWhiteboardAndClinet / user: %v - whiteboard: %v", client.UserId, whiteboardId)
 	swh.mu.Lock()
 	// Add conversation to hub if not exists
 	if _, exists := swh.hub.Whiteboards[whiteboardId]; !exists {
 		swh.hub.Whiteboards[whiteboardId] = []*models.SocketClient{}
 	}
 	// Add client to conversation if not exists
-	if isMember := slices.Contains(swh.hub.Whiteboards[whiteboardId], &models.SocketClient{Conn: ws, UserId: userId}); !isMember {
-		log.Printf("Adding user %v to %v whiteboard observers.", userId, whiteboardId)
-		swh.hub.Whiteboards[whiteboardId] =
-			append(swh.hub.Whiteboards[whiteboardId],
-				&models.SocketClient{
-					Conn:   ws,
-					UserId: userId,
-				},
-			)
+	if isMember := slices.Contains(swh.hub.Whiteboards[whiteboardId], client); !isMember {
+		log.Printf("Adding user %v to %v whiteboard observers.", client.UserId, whiteboardId)
+		swh.hub.Whiteboards[whiteboardId] = append(swh.hub.Whiteboards[whiteboardId], client)
 	}
 	swh.mu.Unlock()
 	swh.logHub()
 }
 
-func (swh *SocketWhiteboardHandler) handleIncommingWhiteboardEvent(ws *websocket.Conn, userInfo *models.Claims, whiteboardId uint) {
+func (swh *SocketWhiteboardHandler) handleIncommingWhiteboardEvent(client *models.SocketClient, whiteboardId uint) {
 	for {
 		var event models.WhiteboardSocketEvent
-		err := ws.ReadJSON(&event)
+		err := client.Conn.ReadJSON(&event)
 		if err != nil {
-			if websocket.IsCloseError(err,
-				websocket.CloseAbnormalClosure,
-				websocket.CloseNormalClosure,
-				websocket.CloseNoStatusReceived,
-			) {
-				log.Printf("SocketWhiteboardHandler / handleIncommingWhiteboardEvent / connection closed by client side - Error: %v", err)
-				swh.deleteDiconnectedClientFromWhiteboard(userInfo.ID, whiteboardId)
-				break
+			if isMalformedMessageError(err) {
+				log.Printf("handleIncommingWhiteboardEvent / Error reading json: %v", err)
+				continue
 			}
-			log.Printf("handleIncommingMessagesWithEvent / Error reading json: %v", err)
-			continue
+			log.Printf("SocketWhiteboardHandler / handleIncommingWhiteboardEvent / connection closed - Error: %v", err)
+			swh.deleteDiconnectedClientFromWhiteboard(client, whiteboardId)
+			break
 		}
 
 		log.Printf("handleIncommingWhiteboardEvent / Event: %+v", event)
 
 		// Handle event
-		switch event.Event {
-		case enums.SOCKET_EVENT_UPDATE_WHITEBOARD:
-			errs := swh.handleUpdateWhiteboardEvent(event)
-			if len(errs) > 0 {
-				log.Printf("handleIncommingWhiteboardEvent - Error while handling SOCKET_EVENT_UPDATE_WHITEBOARD event: %v", errs)
-			}
-		default:
-			log.Printf("Unknown event: %v", event)
+		errs := swh.handleEvent(event)
+		if len(errs) > 0 {
+			log.Printf("handleIncommingWhiteboardEvent - Error while handling %v event: %v", event.Event, errs)
 		}
+		if event.RequestID != "" {
+			client.Send(newSocketAck(event.RequestID, event.Event, nil, errs))
+		}
+	}
+}
+
+func (swh *SocketWhiteboardHandler) handleEvent(event models.WhiteboardSocketEvent) []error {
+	switch event.Event {
+	case enums.SOCKET_EVENT_UPDATE_WHITEBOARD:
+		return swh.handleUpdateWhiteboardEvent(event)
+	default:
+		return []error{errs.ErrUnknownSocketEvent}
 	}
 }
 
@@ -217,19 +220,19 @@ func (swh *SocketWhiteboardHandler) handleUpdateWhiteboardEvent(event models.Whi
 		return errors
 	}
 	log.Println("handleUpdateWhiteboardEvent / jsonEvent: ", string(jsonEvent))
-	if err := swh.publish(swh.Redis, redisModels.REDIS_CHANNEL_WHITEBOARD, jsonEvent); err != nil {
+	if err := swh.publish(redisModels.REDIS_CHANNEL_WHITEBOARD, jsonEvent); err != nil {
 		errors = append(errors, err)
 		return errors
 	}
 	return nil
 }
 
-func (swh *SocketWhiteboardHandler) deleteDiconnectedClientFromWhiteboard(userId uint, whiteboardId uint) {
+func (swh *SocketWhiteboardHandler) deleteDiconnectedClientFromWhiteboard(disconnected *models.SocketClient, whiteboardId uint) {
 	swh.mu.Lock()
 	defer swh.mu.Unlock()
 	// Remove disconnected client from conversation
 	for i, client := range swh.hub.Whiteboards[whiteboardId] {
-		if client.UserId == userId {
+		if client == disconnected {
 			swh.hub.Whiteboards[whiteboardId] = append(swh.hub.Whiteboards[whiteboardId][:i], swh.hub.Whiteboards[whiteboardId][i+1:]...)
 			break
 		}
@@ -251,16 +254,18 @@ func (swh *SocketWhiteboardHandler) logHub() {
 	}
 }
 
-// This function will run in a goroutine to listen to redis pubsub channel
-func (swh *SocketWhiteboardHandler) handleRedisMessages() {
-	ch := swh.SubscribeToChannel(swh.Redis, redisModels.REDIS_CHANNEL_WHITEBOARD)
-	for msg := range ch {
+// Subscribes to the whiteboard channel of the broker
+func (swh *SocketWhiteboardHandler) handleBrokerMessages() {
+	err := swh.broker.Subscribe(redisModels.REDIS_CHANNEL_WHITEBOARD, "", func(message *models.BrokerMessage) {
 		var redisMessage models.WhiteboardSocketEvent
-		if err := json.Unmarshal([]byte(msg.Payload), &redisMessage); err != nil {
+		if err := json.Unmarshal(message.Payload, &redisMessage); err != nil {
 			log.Printf("Error unmarshalling message: %v", err)
-			continue
+			return
 		}
 		swh.send(redisMessage)
+	})
+	if err != nil {
+		log.Fatalf("Could not subscribe to channel: %v", err)
 	}
 }
 
@@ -272,13 +277,10 @@ func (swh *SocketWhiteboardHandler) send(redisMessage models.WhiteboardSocketEve
 		log.Printf("send / whiteboard found, id: %v", redisMessage.Payload.WhiteboardId)
 		for _, client := range whiteboard {
 			log.Printf("send / client: %v", client.UserId)
-			if err := client.Conn.WriteJSON(redisMessage); err != nil {
-				log.Printf("Error writing json: %v", err)
-				err := client.Conn.Close()
-				if err != nil {
-					return
-				}
-				swh.deleteDiconnectedClientFromWhiteboard(client.UserId, redisMessage.Payload.WhiteboardId)
+			// Clients that can't take the event are closed by their own pump,
+			// their read loop then removes them from the whiteboard
+			if !client.SendOnChannel(enums.SOCKET_CHANNEL_WHITEBOARD, redisMessage) {
+				log.Printf("send / event dropped for client %v", client.UserId)
 			}
 		}
 	} else {
@@ -286,17 +288,65 @@ func (swh *SocketWhiteboardHandler) send(redisMessage models.WhiteboardSocketEve
 	}
 }
 
-func (swh *SocketWhiteboardHandler) publish(redis *redis.Client, channel string, message []byte) error {
-	return redis.Publish(swh.ctx, channel, message).Err()
+func (swh *SocketWhiteboardHandler) isSubscribed(client *models.SocketClient, whiteboardId uint) bool {
+	swh.mu.Lock()
+	defer swh.mu.Unlock()
+	return slices.Contains(swh.hub.Whiteboards[whiteboardId], client)
 }
 
-func (swh *SocketWhiteboardHandler) SubscribeToChannel(redis *redis.Client, channel string) <-chan *redis.Message {
-	pubsub := redis.Subscribe(swh.ctx, channel)
-	_, err := pubsub.Receive(swh.ctx)
-	if err != nil {
-		log.Fatalf("Could not subscribe to channel: %v", err)
+// Connect is a no-op, clients of the multiplexed socket join whiteboards through Subscribe
+func (swh *SocketWhiteboardHandler) Connect(client *models.SocketClient) {}
+
+// Disconnect removes the client from every whiteboard it joined
+func (swh *SocketWhiteboardHandler) Disconnect(client *models.SocketClient) {
+	var whiteboardIds []uint
+	swh.mu.Lock()
+	for whiteboardId, clients := range swh.hub.Whiteboards {
+		if slices.Contains(clients, client) {
+			whiteboardIds = append(whiteboardIds, whiteboardId)
+		}
+	}
+	swh.mu.Unlock()
+	for _, whiteboardId := range whiteboardIds {
+		swh.deleteDiconnectedClientFromWhiteboard(client, whiteboardId)
+	}
+}
+
+func (swh *SocketWhiteboardHandler) Subscribe(client *models.SocketClient, whiteboardId uint, payload json.RawMessage) error {
+	// Whiteboards of other conversations are reported as missing
+	if !swh.whiteboardService.CheckUserInWhiteboard(client.UserId, whiteboardId) {
+		return errs.ErrInvalidwhiteboardId
+	}
+	swh.handleWhiteboardAndClinet(client, whiteboardId)
+	return nil
+}
+
+func (swh *SocketWhiteboardHandler) Unsubscribe(client *models.SocketClient, whiteboardId uint) {
+	swh.deleteDiconnectedClientFromWhiteboard(client, whiteboardId)
+}
+
+func (swh *SocketWhiteboardHandler) HandleEvent(client *models.SocketClient, userInfo *models.Claims, whiteboardId uint, event string, payload json.RawMessage) (any, []error) {
+	if !swh.isSubscribed(client, whiteboardId) {
+		return nil, []error{errs.ErrNotSubscribed}
+	}
+	var whiteboardPayload models.WhiteboardSocketPayload
+	if err := json.Unmarshal(payload, &whiteboardPayload); err != nil {
+		return nil, []error{errs.ErrInvalidRequest}
 	}
-	return pubsub.Channel()
+	// Events can only target the whiteboard they were sent on
+	whiteboardPayload.WhiteboardId = whiteboardId
+	if errs := swh.handleEvent(models.WhiteboardSocketEvent{
+		Event:   event,
+		Payload: whiteboardPayload,
+	}); len(errs) > 0 {
+		return nil, errs
+	}
+	return whiteboardPayload, nil
+}
+
+func (swh *SocketWhiteboardHandler) publish(channel string, message []byte) error {
+	_, err := swh.broker.Publish(channel, message)
+	return err
 }
 
 func (swh *SocketWhiteboardHandler) WaitForShutdown(httpServer *http.Server) {
@@ -313,10 +363,7 @@ func (swh *SocketWhiteboardHandler) WaitForShutdown(httpServer *http.Server) {
 	swh.mu.Lock()
 	for whiteboardId, clients := range swh.hub.Whiteboards {
 		for _, client := range clients {
-			err := client.Conn.Close()
-			if err != nil {
-				return
-			}
+			client.Close()
 		}
 		delete(swh.hub.Whiteboards, whiteboardId)
 	}
@@ -0,0 +1,20 @@
+package interfaces
+
+import "socketChat/internal/models"
+
+// Broker fans socket events out between application instances.
+// Each channel keeps a bounded log of its messages so missed ones can be replayed.
+type Broker interface {
+	// Publish appends the message to the channel and returns its ID
+	Publish(channel string, message []byte) (string, error)
+	// Subscribe calls handler, in order, for every message published on the channel after afterId,
+	// or from now on if afterId is empty.
+	// A channel has at most one handler, subscribing again replaces it.
+	Subscribe(channel string, afterId string, handler func(message *models.BrokerMessage)) error
+	Unsubscribe(channel string) error
+	// Replay returns up to limit messages published on the channel after afterId, up to and including untilId
+	Replay(channel string, afterId string, untilId string, limit int64) ([]*models.BrokerMessage, error)
+	// LastID returns the ID of the newest message of the channel, or "0-0" if it has none
+	LastID(channel string) (string, error)
+	Close() error
+}
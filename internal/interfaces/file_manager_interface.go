@@ -1,7 +1,25 @@
 package interfaces
 
-import "io"
+import (
+	"io"
+	"socketChat/internal/models"
+	"time"
+)
 
+// FileManager stores files in buckets. Buckets are private, files are read
+// through short-lived presigned URLs or by the application itself.
 type FileManager interface {
+	// UploadFile stores the file and returns its path inside the storage
 	UploadFile(fileName string, file io.Reader, fileSize int64, contentType string, bucketName string) (string, error)
-}
\ No newline at end of file
+	// Download returns the content of the file, the caller must close it
+	Download(bucketName string, fileName string) (io.ReadCloser, *models.FileInfo, error)
+	Delete(bucketName string, fileName string) error
+	// Stat returns errs.ErrFileNotFound if the file does not exist
+	Stat(bucketName string, fileName string) (*models.FileInfo, error)
+	// PresignGet returns a URL anyone can download the file with until it expires
+	PresignGet(bucketName string, fileName string, expiry time.Duration) (string, error)
+	// PresignPut returns a URL anyone can upload the file with until it expires
+	PresignPut(bucketName string, fileName string, expiry time.Duration) (string, error)
+	// List calls fn with every file of the bucket, in no particular order, and stops at the first error fn returns
+	List(bucketName string, fn func(info *models.FileInfo) error) error
+}
@@ -0,0 +1,14 @@
+package interfaces
+
+import (
+	"io"
+	"socketChat/internal/models"
+)
+
+// FileScanner looks for malware in files
+type FileScanner interface {
+	// Scan returns an error if the file could not be scanned, not if it is infected
+	Scan(file io.Reader) (*models.ScanResult, error)
+	// MaxFileSize returns the size of the largest file the scanner takes, 0 if there is no limit
+	MaxFileSize() int64
+}
@@ -0,0 +1,19 @@
+package interfaces
+
+import (
+	"encoding/json"
+	"socketChat/internal/models"
+)
+
+// SocketTopic is a module served behind the multiplexed socket endpoint.
+// The id passed to Subscribe, Unsubscribe and HandleEvent is the conversation,
+// notifier or whiteboard ID depending on the topic.
+// The payload of Subscribe is the raw payload of the subscribe frame.
+// HandleEvent returns the entity persisted or published by the event, sent back in ack frames.
+type SocketTopic interface {
+	Connect(client *models.SocketClient)
+	Disconnect(client *models.SocketClient)
+	Subscribe(client *models.SocketClient, id uint, payload json.RawMessage) error
+	Unsubscribe(client *models.SocketClient, id uint)
+	HandleEvent(client *models.SocketClient, userInfo *models.Claims, id uint, event string, payload json.RawMessage) (any, []error)
+}
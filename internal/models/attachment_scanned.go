@@ -0,0 +1,9 @@
+package models
+
+// AttachmentScanned tells the members of a conversation that an attachment of one of its messages was scanned.
+// Quarantined attachments stay concealed.
+type AttachmentScanned struct {
+	MessageID      uint               `json:"message_id"`
+	ConversationID uint               `json:"conversation_id"`
+	Attachment     *MessageAttachment `json:"attachment"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// AttachmentVariant is a downscaled copy of an image attachment, stored next to the original
+type AttachmentVariant struct {
+	gorm.Model
+	AttachmentID uint `gorm:"index;not null" json:"-"`
+	// Longest side the variant was generated for
+	Size      int    `gorm:"not null" json:"size"`
+	Width     int    `gorm:"not null" json:"width"`
+	Height    int    `gorm:"not null" json:"height"`
+	MimeType  string `gorm:"not null" json:"mime_type"`
+	ObjectKey string `gorm:"not null" json:"-"`
+	// Path of the file inside the storage, clients download it through the URL of its attachment
+	URL string `gorm:"not null" json:"-"`
+}
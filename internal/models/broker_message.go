@@ -0,0 +1,9 @@
+package models
+
+// BrokerMessage is a message delivered by a message broker
+type BrokerMessage struct {
+	// Broker assigned, monotonically increasing ID of the message in its channel
+	ID      string
+	Channel string
+	Payload []byte
+}
@@ -11,4 +11,7 @@ type ConversationMember struct {
 	ConversationID uint      `json:"conversation_id"`
 	UserID         uint      `json:"user_id"`
 	JoinedAt       time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"joined_at"`
+	// Read cursor, every main timeline message up to this one has been read by the member
+	LastReadMessageID uint       `gorm:"not null;default:0" json:"last_read_message_id"`
+	LastReadAt        *time.Time `json:"last_read_at"`
 }
@@ -0,0 +1,7 @@
+package models
+
+type CreateUploadRequest struct {
+	FileName    string `json:"file_name"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+}
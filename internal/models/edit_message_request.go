@@ -0,0 +1,5 @@
+package models
+
+type EditMessageRequest struct {
+	Content string `json:"content"`
+}
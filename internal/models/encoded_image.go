@@ -0,0 +1,10 @@
+package models
+
+// EncodedImage is an image ready to be uploaded
+type EncodedImage struct {
+	Data        []byte
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+}
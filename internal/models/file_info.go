@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type FileInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// GarbageCollectionReport tells what a run of the garbage collector found and removed.
+// Nothing is removed in dry runs, the report tells what would have been.
+type GarbageCollectionReport struct {
+	DryRun     bool      `json:"dry_run"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Attachments never sent and older than the abandonment age
+	AbandonedAttachments int                      `json:"abandoned_attachments"`
+	Buckets              []BucketCollectionReport `json:"buckets"`
+}
+
+type BucketCollectionReport struct {
+	Bucket string `json:"bucket"`
+	// Files older than the grace period
+	Scanned       int   `json:"scanned"`
+	Orphaned      int   `json:"orphaned"`
+	OrphanedBytes int64 `json:"orphaned_bytes"`
+	Deleted       int   `json:"deleted"`
+	// First orphaned keys, for review of dry runs
+	OrphanedKeys []string `json:"orphaned_keys,omitempty"`
+	Errors       []string `json:"errors,omitempty"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// HiddenMessage hides a message from a single member after a delete-for-me
+type HiddenMessage struct {
+	gorm.Model
+	MessageID uint    `gorm:"uniqueIndex:idx_hidden_message_user;not null" json:"message_id"`
+	Message   Message `json:"-"`
+	UserID    uint    `gorm:"uniqueIndex:idx_hidden_message_user;not null" json:"user_id"`
+}
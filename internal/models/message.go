@@ -8,9 +8,57 @@ import (
 
 type Message struct {
 	gorm.Model
-	ConversationID uint         `json:"conversation_id"`
-	Conversation   Conversation `json:"-"`
-	SenderID       uint         `json:"sender_id"`
-	Content        string       `gorm:"not null" json:"content"`
-	SeenAt         *time.Time   `json:"seen_at"`
+	ConversationID uint                `json:"conversation_id"`
+	Conversation   Conversation        `json:"-"`
+	SenderID       uint                `gorm:"uniqueIndex:idx_message_sender_client" json:"sender_id"`
+	ClientID       *string             `gorm:"uniqueIndex:idx_message_sender_client;size:36" json:"client_id,omitempty"`
+	Content        string              `gorm:"not null" json:"content"`
+	SeenAt         *time.Time          `json:"seen_at"`
+	EditedAt       *time.Time          `json:"edited_at"`
+	ReplyToID      *uint               `gorm:"index" json:"reply_to_id"`
+	ReplyTo        *MessagePreview     `gorm:"-" json:"reply_to,omitempty"`
+	ThreadRootID   *uint               `gorm:"index" json:"thread_root_id"`
+	Thread         *ThreadSummary      `gorm:"-" json:"thread,omitempty"`
+	ReadReceipt    *ReadReceipt        `gorm:"-" json:"read_receipt,omitempty"`
+	Attachments    []MessageAttachment `json:"attachments,omitempty"`
+	Reactions      []ReactionSummary   `gorm:"-" json:"reactions,omitempty"`
+	IsDeleted      bool                `gorm:"-" json:"is_deleted"`
+}
+
+// Tombstone strips the content of a message deleted for everyone,
+// keeping its place in the conversation history
+func (m *Message) Tombstone() {
+	if !m.DeletedAt.Valid {
+		return
+	}
+	m.Content = ""
+	m.Attachments = nil
+	m.IsDeleted = true
+}
+
+// ConcealAttachments conceals the attachments not scanned clean from everyone but their uploader,
+// viewerID 0 conceals them from everyone
+func (m *Message) ConcealAttachments(viewerID uint) {
+	for i := range m.Attachments {
+		if m.Attachments[i].UploaderID != viewerID || viewerID == 0 {
+			m.Attachments[i].Conceal()
+		}
+	}
+}
+
+func (m *Message) ToMessagePreview() *MessagePreview {
+	preview := &MessagePreview{
+		ID:        m.ID,
+		SenderID:  m.SenderID,
+		IsDeleted: m.DeletedAt.Valid,
+	}
+	if preview.IsDeleted {
+		return preview
+	}
+	snippet := []rune(m.Content)
+	if len(snippet) > messagePreviewSnippetLength {
+		snippet = snippet[:messagePreviewSnippetLength]
+	}
+	preview.Snippet = string(snippet)
+	return preview
 }
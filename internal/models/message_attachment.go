@@ -0,0 +1,47 @@
+package models
+
+import (
+	"socketChat/internal/enums"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MessageAttachment is a file uploaded to be sent with a message.
+// It is not linked to a message until the message referencing it is sent.
+type MessageAttachment struct {
+	gorm.Model
+	MessageID  *uint  `gorm:"index" json:"message_id"`
+	UploaderID uint   `gorm:"index;not null" json:"uploader_id"`
+	Bucket     string `gorm:"not null;index:idx_attachment_object" json:"-"`
+	ObjectKey  string `gorm:"not null;index:idx_attachment_object" json:"-"`
+	FileName   string `gorm:"not null" json:"file_name"`
+	MimeType   string `gorm:"not null" json:"mime_type"`
+	Size       int64  `gorm:"not null" json:"size"`
+	// Set for images only
+	Width  *int `json:"width"`
+	Height *int `json:"height"`
+	// Path of the file inside the storage, buckets are private and clients download it through a presigned URL
+	URL string `gorm:"not null" json:"-"`
+	// Filled in by the thumbnail worker once the image is processed
+	Blurhash      *string             `json:"blurhash"`
+	DominantColor *string             `json:"dominant_color"`
+	Variants      []AttachmentVariant `gorm:"foreignKey:AttachmentID" json:"variants,omitempty"`
+	// One of enums.ATTACHMENT_SCAN_STATUS_*, files are readable by the uploader only until they are scanned clean
+	ScanStatus string     `gorm:"index;not null;default:pending" json:"scan_status"`
+	ScannedAt  *time.Time `json:"scanned_at"`
+	// Name of the threat a quarantined file was found to carry
+	ScanThreat *string `json:"-"`
+	// Scans the file failed, the attachment is marked failed once they reach scanner.max_attempts
+	ScanAttempts int `gorm:"not null;default:0" json:"-"`
+}
+
+// Conceal hides what the file of an attachment not scanned clean looks like
+func (attachment *MessageAttachment) Conceal() {
+	if attachment.ScanStatus == enums.ATTACHMENT_SCAN_STATUS_CLEAN {
+		return
+	}
+	attachment.Blurhash = nil
+	attachment.DominantColor = nil
+	attachment.Variants = nil
+}
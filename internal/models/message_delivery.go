@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MessageDelivery records when a message first reached one of the recipient's devices
+type MessageDelivery struct {
+	gorm.Model
+	MessageID   uint      `gorm:"uniqueIndex:idx_message_delivery_user;not null" json:"message_id"`
+	Message     Message   `json:"-"`
+	UserID      uint      `gorm:"uniqueIndex:idx_message_delivery_user;not null" json:"user_id"`
+	DeliveredAt time.Time `gorm:"not null" json:"delivered_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// MessageEdit keeps a prior revision of an edited message
+type MessageEdit struct {
+	gorm.Model
+	MessageID uint    `gorm:"index;not null" json:"message_id"`
+	Message   Message `json:"-"`
+	Content   string  `gorm:"not null" json:"content"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// Maximum number of characters of the quoted content in a preview
+const messagePreviewSnippetLength = 100
+
+// MessagePreview is a compact view of a quoted message
+type MessagePreview struct {
+	ID        uint   `json:"id"`
+	SenderID  uint   `json:"sender_id"`
+	Snippet   string `json:"snippet"`
+	IsDeleted bool   `json:"is_deleted"`
+}
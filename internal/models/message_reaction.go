@@ -0,0 +1,13 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+type MessageReaction struct {
+	gorm.Model
+	MessageID uint    `gorm:"uniqueIndex:idx_message_reaction;not null" json:"message_id"`
+	Message   Message `json:"-"`
+	UserID    uint    `gorm:"uniqueIndex:idx_message_reaction;not null" json:"user_id"`
+	Emoji     string  `gorm:"uniqueIndex:idx_message_reaction;not null" json:"emoji"`
+}
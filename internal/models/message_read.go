@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MessageRead records when a member of the conversation read a message
+type MessageRead struct {
+	gorm.Model
+	MessageID uint      `gorm:"uniqueIndex:idx_message_read_user;not null" json:"message_id"`
+	Message   Message   `json:"-"`
+	UserID    uint      `gorm:"uniqueIndex:idx_message_read_user;not null" json:"user_id"`
+	ReadAt    time.Time `gorm:"not null" json:"read_at"`
+}
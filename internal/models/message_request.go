@@ -1,6 +1,10 @@
 package models
 
 type MessageRequest struct {
-	ConversationID uint   `json:"conversation_id"`
-	Content        string `json:"content"`
-}
\ No newline at end of file
+	ConversationID uint    `json:"conversation_id"`
+	Content        string  `json:"content"`
+	ReplyToID      *uint   `json:"reply_to_id"`
+	ThreadRootID   *uint   `json:"thread_root_id"`
+	ClientID       *string `json:"client_id"`
+	AttachmentIDs  []uint  `json:"attachment_ids"`
+}
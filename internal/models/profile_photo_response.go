@@ -0,0 +1,7 @@
+package models
+
+type ProfilePhotoResponse struct {
+	ProfilePhoto          string `json:"profile_photo"`
+	ProfilePhotoThumbnail string `json:"profile_photo_thumbnail"`
+	ProfilePhotoBlurhash  string `json:"profile_photo_blurhash"`
+}
@@ -1,9 +1,11 @@
 package models
 
 type ProfileResponse struct {
-	ID           uint    `json:"id"`
-	Email        string  `json:"email"`
-	FirstName    string  `json:"first_name"`
-	LastName     string  `json:"last_name"`
-	ProfilePhoto *string `json:"profile_photo"`
+	ID                    uint    `json:"id"`
+	Email                 string  `json:"email"`
+	FirstName             string  `json:"first_name"`
+	LastName              string  `json:"last_name"`
+	ProfilePhoto          *string `json:"profile_photo"`
+	ProfilePhotoThumbnail *string `json:"profile_photo_thumbnail"`
+	ProfilePhotoBlurhash  *string `json:"profile_photo_blurhash"`
 }
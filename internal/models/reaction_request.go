@@ -0,0 +1,5 @@
+package models
+
+type ReactionRequest struct {
+	Emoji string `json:"emoji"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// ReactionSummary aggregates the reactions of a message with the same emoji
+type ReactionSummary struct {
+	MessageID   uint   `json:"-"`
+	Emoji       string `json:"emoji"`
+	Count       int64  `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"socketChat/internal/enums"
+	"time"
+)
+
+// ReadReceipt tells how many of the other members of the conversation got and read a message, and who read it
+type ReadReceipt struct {
+	// One of enums.MESSAGE_STATUS_*
+	Status         string          `json:"status"`
+	DeliveredCount int             `json:"delivered_count"`
+	SeenCount      int             `json:"seen_count"`
+	MemberCount    int             `json:"member_count"`
+	Readers        []MessageReader `json:"readers"`
+}
+
+type MessageReader struct {
+	UserID uint      `json:"user_id"`
+	ReadAt time.Time `json:"read_at"`
+}
+
+// ResolveStatus sets the status from the counts, a message is delivered or read once
+// it is delivered to or read by every other member
+func (rr *ReadReceipt) ResolveStatus() {
+	// Reading implies the message was delivered
+	rr.DeliveredCount = max(rr.DeliveredCount, rr.SeenCount)
+	switch {
+	case rr.MemberCount > 0 && rr.SeenCount >= rr.MemberCount:
+		rr.Status = enums.MESSAGE_STATUS_READ
+	case rr.MemberCount > 0 && rr.DeliveredCount >= rr.MemberCount:
+		rr.Status = enums.MESSAGE_STATUS_DELIVERED
+	default:
+		rr.Status = enums.MESSAGE_STATUS_SENT
+	}
+}
@@ -1,7 +1,14 @@
 package models
 
+import "fmt"
+
 const (
 	REDIS_CHANNEL_CHAT       = "chat_channel"
 	REDIS_CHANNEL_OBSERVE    = "observing_channel"
 	REDIS_CHANNEL_WHITEBOARD = "whiteboard_channel"
 )
+
+// ChatConversationChannel is the channel carrying the events of a single conversation
+func ChatConversationChannel(conversationId uint) string {
+	return fmt.Sprintf("%v_%d", REDIS_CHANNEL_CHAT, conversationId)
+}
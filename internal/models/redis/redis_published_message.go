@@ -1,7 +1,11 @@
 package models
 
 type RedisPublishedMessage struct {
+	// Broker message ID, clients send the last one they saw to resume
+	EventID        string `json:"event_id,omitempty"`
 	Event          string `json:"event"`
 	ConversationID uint   `json:"conversation_id"`
-	Payload        any    `json:"payload"`
+	// Set on thread replies so clients can route them to the thread panel
+	ThreadRootID *uint `json:"thread_root_id,omitempty"`
+	Payload      any   `json:"payload"`
 }
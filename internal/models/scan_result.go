@@ -0,0 +1,7 @@
+package models
+
+type ScanResult struct {
+	Infected bool
+	// Name of the detected threat, empty if the file is clean
+	Threat string
+}
@@ -0,0 +1,7 @@
+package models
+
+type DeleteMessagePayload struct {
+	MessageID uint `json:"message_id"`
+	// One of enums.MESSAGE_DELETE_SCOPE_*
+	Scope string `json:"scope"`
+}
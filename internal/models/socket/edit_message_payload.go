@@ -0,0 +1,6 @@
+package models
+
+type EditMessagePayload struct {
+	MessageID uint   `json:"message_id"`
+	Content   string `json:"content"`
+}
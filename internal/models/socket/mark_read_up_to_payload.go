@@ -0,0 +1,6 @@
+package models
+
+type MarkReadUpToPayload struct {
+	MessageID uint `json:"message_id"`
+	UserID    uint `json:"user_id"`
+}
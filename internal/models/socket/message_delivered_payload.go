@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type MessageDeliveredPayload struct {
+	MessageID      uint      `json:"message_id"`
+	ConversationID uint      `json:"conversation_id"`
+	SenderID       uint      `json:"sender_id"`
+	UserID         uint      `json:"user_id"`
+	DeliveredAt    time.Time `json:"delivered_at"`
+}
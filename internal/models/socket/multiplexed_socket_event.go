@@ -0,0 +1,16 @@
+package models
+
+import (
+	"encoding/json"
+)
+
+// MultiplexedSocketEvent is a frame sent by the client on the multiplexed socket.
+// Channel and ID address the conversation, notifier or whiteboard the event is meant for.
+type MultiplexedSocketEvent struct {
+	Channel string          `json:"channel"`
+	ID      uint            `json:"id"`
+	Event   string          `json:"event"`
+	Payload json.RawMessage `json:"payload"`
+	// Optional, when set the server answers with an ack or error frame
+	RequestID string `json:"request_id"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// MultiplexedSocketMessage wraps every event delivered on the multiplexed socket
+// with the channel it was published on
+type MultiplexedSocketMessage struct {
+	Channel string `json:"channel"`
+	Message any    `json:"message"`
+}
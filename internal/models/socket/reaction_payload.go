@@ -0,0 +1,7 @@
+package models
+
+type ReactionPayload struct {
+	MessageID uint   `json:"message_id"`
+	UserID    uint   `json:"user_id"`
+	Emoji     string `json:"emoji"`
+}
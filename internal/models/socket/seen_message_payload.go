@@ -2,4 +2,5 @@ package models
 
 type SeenMessagePayload struct {
 	MessageIds []uint `json:"message_ids"`
+	UserID     uint   `json:"user_id"`
 }
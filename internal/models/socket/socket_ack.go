@@ -0,0 +1,14 @@
+package models
+
+// SocketAck answers an inbound event that carried a request ID
+type SocketAck struct {
+	// enums.SOCKET_EVENT_ACK or enums.SOCKET_EVENT_ERROR
+	Type      string `json:"type"`
+	RequestID string `json:"request_id"`
+	Event     string `json:"event"`
+	// Machine-readable code of the first error, see errs.Code
+	Code   string   `json:"code,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+	// Entity persisted or published by the event
+	Data any `json:"data,omitempty"`
+}
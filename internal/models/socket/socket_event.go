@@ -8,4 +8,6 @@ type SocketEvent struct {
 	Event          string          `json:"event"`
 	Payload        json.RawMessage `json:"payload"`
 	ConversationID uint            `json:"conversation_id"`
+	// Optional, when set the server answers with an ack or error frame
+	RequestID string `json:"request_id"`
 }
@@ -0,0 +1,6 @@
+package models
+
+type SubscribePayload struct {
+	// Last event ID received before reconnecting, events published after it are replayed
+	LastEventID string `json:"last_event_id"`
+}
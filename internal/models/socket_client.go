@@ -1,8 +1,182 @@
 package models
 
-import "github.com/gorilla/websocket"
+import (
+	"log"
+	"socketChat/internal/enums"
+	socketModels "socketChat/internal/models/socket"
+	"sync"
+	"time"
 
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultSendQueueSize = 256
+	defaultWriteTimeout  = 10 * time.Second
+	defaultPongTimeout   = 60 * time.Second
+)
+
+// SocketClient owns a websocket connection and is the only writer to it.
+// Hubs hand events to Send and the WritePump goroutine delivers them,
+// so a slow peer never blocks the hub or other clients.
+// The pump also pings the peer, and a peer that stops answering hits the
+// read deadline so its reader fails and the hub cleanup runs.
 type SocketClient struct {
 	Conn   *websocket.Conn
 	UserId uint
+
+	options     SocketClientOptions
+	multiplexed bool
+	send        chan any
+	done        chan struct{}
+	mu          sync.Mutex
+	closeOnce   sync.Once
+}
+
+func NewSocketClient(conn *websocket.Conn, userId uint, options *SocketClientOptions) *SocketClient {
+	opts := SocketClientOptions{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.SendQueueSize <= 0 {
+		opts.SendQueueSize = defaultSendQueueSize
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = defaultWriteTimeout
+	}
+	if opts.SlowClientPolicy == "" {
+		opts.SlowClientPolicy = enums.SLOW_CLIENT_POLICY_DROP_OLDEST
+	}
+	if opts.PongTimeout <= 0 {
+		opts.PongTimeout = defaultPongTimeout
+	}
+	if opts.PingInterval <= 0 || opts.PingInterval >= opts.PongTimeout {
+		opts.PingInterval = opts.PongTimeout * 9 / 10
+	}
+
+	sc := &SocketClient{
+		Conn:    conn,
+		UserId:  userId,
+		options: opts,
+		send:    make(chan any, opts.SendQueueSize),
+		done:    make(chan struct{}),
+	}
+	sc.handlePongs()
+	return sc
+}
+
+// NewMultiplexedSocketClient creates a client for the multiplexed endpoint,
+// whose events are wrapped with the channel they were published on
+func NewMultiplexedSocketClient(conn *websocket.Conn, userId uint, options *SocketClientOptions) *SocketClient {
+	sc := NewSocketClient(conn, userId, options)
+	sc.multiplexed = true
+	return sc
+}
+
+// handlePongs arms the read deadline and pushes it forward on every pong.
+// It must be called before the connection's reader starts.
+func (sc *SocketClient) handlePongs() {
+	if err := sc.Conn.SetReadDeadline(time.Now().Add(sc.options.PongTimeout)); err != nil {
+		log.Printf("SocketClient / handlePongs / error setting read deadline of user %v: %v", sc.UserId, err)
+	}
+	sc.Conn.SetPongHandler(func(string) error {
+		return sc.Conn.SetReadDeadline(time.Now().Add(sc.options.PongTimeout))
+	})
+}
+
+// Send queues the event for delivery without blocking.
+// It returns false if the event could not be queued, either because the
+// client is closed or because it was disconnected for falling behind.
+func (sc *SocketClient) Send(event any) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	select {
+	case <-sc.done:
+		return false
+	default:
+	}
+
+	select {
+	case sc.send <- event:
+		return true
+	default:
+	}
+
+	// The queue is full, apply the slow client policy
+	switch sc.options.SlowClientPolicy {
+	case enums.SLOW_CLIENT_POLICY_DISCONNECT:
+		log.Printf("SocketClient / Send / send queue of user %v is full, disconnecting", sc.UserId)
+		sc.Close()
+		return false
+	default:
+		log.Printf("SocketClient / Send / send queue of user %v is full, dropping oldest event", sc.UserId)
+		select {
+		case <-sc.send:
+		default:
+		}
+		sc.send <- event
+		return true
+	}
+}
+
+// SendOnChannel queues an event published on the given channel.
+// Multiplexed clients receive it wrapped with the channel, others receive it as is.
+func (sc *SocketClient) SendOnChannel(channel string, event any) bool {
+	if sc.multiplexed {
+		return sc.Send(socketModels.MultiplexedSocketMessage{
+			Channel: channel,
+			Message: event,
+		})
+	}
+	return sc.Send(event)
+}
+
+// WritePump delivers queued events and heartbeat pings to the peer until the client is closed.
+// It must run in its own goroutine, one per client.
+func (sc *SocketClient) WritePump() {
+	ticker := time.NewTicker(sc.options.PingInterval)
+	defer func() {
+		ticker.Stop()
+		sc.Close()
+	}()
+	for {
+		select {
+		case event := <-sc.send:
+			if err := sc.write(event); err != nil {
+				log.Printf("SocketClient / WritePump / error writing to user %v: %v", sc.UserId, err)
+				return
+			}
+		case <-ticker.C:
+			if err := sc.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(sc.options.WriteTimeout)); err != nil {
+				log.Printf("SocketClient / WritePump / error pinging user %v: %v", sc.UserId, err)
+				return
+			}
+		case <-sc.done:
+			return
+		}
+	}
+}
+
+func (sc *SocketClient) write(event any) error {
+	if err := sc.Conn.SetWriteDeadline(time.Now().Add(sc.options.WriteTimeout)); err != nil {
+		return err
+	}
+	return sc.Conn.WriteJSON(event)
+}
+
+// Close stops the write pump and closes the underlying connection.
+// The blocked reader of the connection then returns an error and runs the hub cleanup.
+func (sc *SocketClient) Close() {
+	sc.closeOnce.Do(func() {
+		close(sc.done)
+		if err := sc.Conn.Close(); err != nil {
+			log.Printf("SocketClient / Close / error closing connection of user %v: %v", sc.UserId, err)
+		}
+	})
+}
+
+// Done is closed once the client has been closed
+func (sc *SocketClient) Done() <-chan struct{} {
+	return sc.done
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// SocketClientOptions configures the outbound queue and write pump of every socket client
+type SocketClientOptions struct {
+	// Number of outbound events buffered per connection
+	SendQueueSize int
+	// What to do when the queue is full, one of enums.SLOW_CLIENT_POLICY_*
+	SlowClientPolicy string
+	// Maximum time allowed to write a single event to the peer
+	WriteTimeout time.Duration
+	// Interval between server pings, must be shorter than PongTimeout
+	PingInterval time.Duration
+	// How long the peer may stay silent before the connection is considered dead
+	PongTimeout time.Duration
+}
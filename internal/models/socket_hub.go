@@ -1,7 +1,6 @@
 package models
 
 import (
-	"github.com/redis/go-redis/v9"
 	"sync"
 )
 
@@ -9,5 +8,4 @@ type SocketHub struct {
 	// [conversation_id] => []*SocketClient
 	Conversations map[uint][]*SocketClient
 	Mu            sync.Mutex
-	Redis         *redis.Client
 }
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// StorageUsage is what the uploads charged to a user or to a conversation add up to.
+// Deduplicated uploads are charged in full to each of their owners.
+type StorageUsage struct {
+	gorm.Model
+	// One of enums.STORAGE_OWNER_TYPE_*
+	OwnerType string `gorm:"not null;uniqueIndex:idx_storage_usage_owner" json:"owner_type"`
+	OwnerID   uint   `gorm:"not null;uniqueIndex:idx_storage_usage_owner" json:"owner_id"`
+	UsedBytes int64  `gorm:"not null;default:0" json:"used_bytes"`
+	FileCount int64  `gorm:"not null;default:0" json:"file_count"`
+}
@@ -0,0 +1,10 @@
+package models
+
+type StorageUsageResponse struct {
+	OwnerType string `json:"owner_type"`
+	OwnerID   uint   `json:"owner_id"`
+	UsedBytes int64  `json:"used_bytes"`
+	FileCount int64  `json:"file_count"`
+	// 0 means unlimited
+	QuotaBytes int64 `json:"quota_bytes"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// StoredObject is a file stored once under the SHA-256 of its content, shared by every upload
+// of the same content in its bucket. It is removed with its file once nothing references it.
+// Its URL is empty until the file is uploaded.
+type StoredObject struct {
+	gorm.Model
+	Bucket      string `gorm:"not null;uniqueIndex:idx_stored_object_hash;index:idx_stored_object_key"`
+	Hash        string `gorm:"not null;uniqueIndex:idx_stored_object_hash"`
+	ObjectKey   string `gorm:"not null;index:idx_stored_object_key"`
+	URL         string `gorm:"not null;index"`
+	Size        int64  `gorm:"not null"`
+	ContentType string `gorm:"not null"`
+	// Number of uploads sharing the file
+	RefCount int64 `gorm:"not null"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// ThreadSummary describes the replies of a thread root as seen by a member
+type ThreadSummary struct {
+	ThreadRootID uint       `json:"-"`
+	ReplyCount   int64      `json:"reply_count"`
+	LastReplyAt  *time.Time `json:"last_reply_at"`
+	UnreadCount  int64      `json:"unread_count"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Upload is a resumable upload of a large attachment. Chunks are appended at the
+// current offset and the upload becomes an attachment once all of its bytes arrived.
+type Upload struct {
+	gorm.Model
+	UploaderID uint   `gorm:"index;not null" json:"uploader_id"`
+	FileName   string `gorm:"not null" json:"file_name"`
+	MimeType   string `gorm:"not null" json:"mime_type"`
+	Size       int64  `gorm:"not null" json:"size"`
+	// Number of bytes received so far
+	Offset int64 `gorm:"not null;default:0" json:"offset"`
+	// Pushed forward by every chunk, abandoned uploads are removed after it
+	ExpiresAt time.Time `gorm:"index;not null" json:"expires_at"`
+	// Set while the upload is being turned into an attachment
+	CompletedAt *time.Time    `json:"-"`
+	Chunks      []UploadChunk `json:"-"`
+}
+
+// UploadChunk is a stored part of an upload, starting at Offset
+type UploadChunk struct {
+	gorm.Model
+	UploadID  uint   `gorm:"index;not null"`
+	Offset    int64  `gorm:"not null"`
+	Size      int64  `gorm:"not null"`
+	ObjectKey string `gorm:"not null"`
+}
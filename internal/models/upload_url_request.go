@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// UploadUrlRequest asks for a URL to upload an attachment for the conversation straight to the storage
+type UploadUrlRequest struct {
+	ConversationID uint   `json:"conversation_id"`
+	FileName       string `json:"file_name"`
+}
+
+type UploadUrlResponse struct {
+	ObjectKey string    `json:"object_key"`
+	UploadURL string    `json:"upload_url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CompleteUploadRequest records a file uploaded through an upload URL as an attachment
+type CompleteUploadRequest struct {
+	ObjectKey string `json:"object_key"`
+	FileName  string `json:"file_name"`
+}
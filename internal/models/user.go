@@ -8,14 +8,16 @@ import (
 // User represents a user in the application
 type User struct {
 	gorm.Model
-	FirstName    string     `gorm:"not null" json:"first_name"`
-	LastName     string     `gorm:"not null" json:"last_name"`
-	ProfilePhoto *string    `json:"profile_photo"`
-	Email        string     `gorm:"unique;not null" json:"email"`
-	PasswordHash string     `gorm:"not null" json:"-"`
-	Password     string     `gorm:"-" json:"password"`
-	IsOnline     bool       `gorm:"default:false" json:"is_online"`
-	LastSeen     *time.Time `json:"last_seen_at"`
+	FirstName             string     `gorm:"not null" json:"first_name"`
+	LastName              string     `gorm:"not null" json:"last_name"`
+	ProfilePhoto          *string    `json:"profile_photo"`
+	ProfilePhotoThumbnail *string    `json:"profile_photo_thumbnail"`
+	ProfilePhotoBlurhash  *string    `json:"profile_photo_blurhash"`
+	Email                 string     `gorm:"unique;not null" json:"email"`
+	PasswordHash          string     `gorm:"not null" json:"-"`
+	Password              string     `gorm:"-" json:"password"`
+	IsOnline              bool       `gorm:"default:false" json:"is_online"`
+	LastSeen              *time.Time `json:"last_seen_at"`
 }
 
 func (user *User) ToUserResponse() *UserResponse {
@@ -23,21 +25,25 @@ func (user *User) ToUserResponse() *UserResponse {
 	// time.Sleep(time.Millisecond * 100)
 
 	return &UserResponse{
-		ID:           user.ID,
-		FirstName:    user.FirstName,
-		LastName:     user.LastName,
-		ProfilePhoto: user.ProfilePhoto,
-		IsOnline:     user.IsOnline,
-		LastSeen:     user.LastSeen,
+		ID:                    user.ID,
+		FirstName:             user.FirstName,
+		LastName:              user.LastName,
+		ProfilePhoto:          user.ProfilePhoto,
+		ProfilePhotoThumbnail: user.ProfilePhotoThumbnail,
+		ProfilePhotoBlurhash:  user.ProfilePhotoBlurhash,
+		IsOnline:              user.IsOnline,
+		LastSeen:              user.LastSeen,
 	}
 }
 
 func (user *User) ToProfileResponse() *ProfileResponse {
 	return &ProfileResponse{
-		ID:           user.ID,
-		Email:        user.Email,
-		FirstName:    user.FirstName,
-		LastName:     user.LastName,
-		ProfilePhoto: user.ProfilePhoto,
+		ID:                    user.ID,
+		Email:                 user.Email,
+		FirstName:             user.FirstName,
+		LastName:              user.LastName,
+		ProfilePhoto:          user.ProfilePhoto,
+		ProfilePhotoThumbnail: user.ProfilePhotoThumbnail,
+		ProfilePhotoBlurhash:  user.ProfilePhotoBlurhash,
 	}
-}
\ No newline at end of file
+}
@@ -3,10 +3,12 @@ package models
 import "time"
 
 type UserResponse struct {
-	ID           uint       `json:"id"`
-	FirstName    string     `json:"first_name"`
-	LastName     string     `json:"last_name"`
-	ProfilePhoto *string    `json:"profile_photo"`
-	IsOnline     bool       `json:"is_online"`
-	LastSeen     *time.Time `json:"last_seen_at"`
+	ID                    uint       `json:"id"`
+	FirstName             string     `json:"first_name"`
+	LastName              string     `json:"last_name"`
+	ProfilePhoto          *string    `json:"profile_photo"`
+	ProfilePhotoThumbnail *string    `json:"profile_photo_thumbnail"`
+	ProfilePhotoBlurhash  *string    `json:"profile_photo_blurhash"`
+	IsOnline              bool       `json:"is_online"`
+	LastSeen              *time.Time `json:"last_seen_at"`
 }
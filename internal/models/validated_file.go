@@ -0,0 +1,15 @@
+package models
+
+import "io"
+
+// ValidatedFile is an upload whose content was sniffed and checked against the rules of its bucket
+type ValidatedFile struct {
+	File io.Reader
+	// -1 if unknown
+	Size        int64
+	ContentType string
+	// Extension of the sniffed content type, including the dot
+	Extension string
+	// Set for images, which are read into memory and stripped of their metadata
+	Data []byte
+}
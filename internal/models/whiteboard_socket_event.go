@@ -3,4 +3,6 @@ package models
 type WhiteboardSocketEvent struct {
 	Event   string                  `json:"event"`
 	Payload WhiteboardSocketPayload `json:"payload"`
+	// Optional, when set the server answers with an ack or error frame
+	RequestID string `json:"request_id,omitempty"`
 }
@@ -0,0 +1,200 @@
+package repositories
+
+import (
+	"socketChat/internal/enums"
+	"socketChat/internal/errs"
+	"socketChat/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AttachmentRepository struct {
+	db *gorm.DB
+}
+
+func NewAttachmentRepository(db *gorm.DB) *AttachmentRepository {
+	return &AttachmentRepository{
+		db: db,
+	}
+}
+
+func (ar *AttachmentRepository) SaveAttachment(attachment *models.MessageAttachment) (*models.MessageAttachment, []error) {
+	var errors []error
+	if err := ar.db.Create(attachment).Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return attachment, nil
+}
+
+// SaveThumbnails stores the generated variants of an image attachment together with its placeholder
+func (ar *AttachmentRepository) SaveThumbnails(attachmentID uint, variants []models.AttachmentVariant, blurhash string, dominantColor string) []error {
+	var errors []error
+	transactionErr := ar.db.Transaction(func(tx *gorm.DB) error {
+		if len(variants) > 0 {
+			if err := tx.Create(&variants).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.MessageAttachment{}).
+			Where("id = ?", attachmentID).
+			Updates(map[string]interface{}{
+				"blurhash":       blurhash,
+				"dominant_color": dominantColor,
+			}).Error
+	})
+	if transactionErr != nil {
+		errors = append(errors, transactionErr)
+		return errors
+	}
+	return nil
+}
+
+// orderVariants preloads attachment variants smallest first
+func orderVariants(db *gorm.DB) *gorm.DB {
+	return db.Order("size ASC")
+}
+
+func (ar *AttachmentRepository) GetAttachmentById(attachmentID uint) (*models.MessageAttachment, []error) {
+	var errors []error
+	var attachment models.MessageAttachment
+	result := ar.db.Preload("Variants", orderVariants).Where("id = ?", attachmentID).Limit(1).Find(&attachment)
+	if err := result.Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	if result.RowsAffected == 0 {
+		errors = append(errors, errs.ErrAttachmentNotFound)
+		return nil, errors
+	}
+	return &attachment, nil
+}
+
+// GetThumbnailedAttachment returns an attachment of the stored file whose thumbnails were generated already
+func (ar *AttachmentRepository) GetThumbnailedAttachment(bucket, objectKey string) (*models.MessageAttachment, []error) {
+	var errors []error
+	var attachment models.MessageAttachment
+	result := ar.db.Preload("Variants", orderVariants).
+		Where("bucket = ? AND object_key = ? AND blurhash IS NOT NULL AND dominant_color IS NOT NULL", bucket, objectKey).
+		Limit(1).
+		Find(&attachment)
+	if err := result.Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	if result.RowsAffected == 0 {
+		errors = append(errors, errs.ErrAttachmentNotFound)
+		return nil, errors
+	}
+	return &attachment, nil
+}
+
+// SaveScanResult records the verdict of a pending attachment, it returns false
+// if the attachment was scanned already
+func (ar *AttachmentRepository) SaveScanResult(attachmentID uint, status string, threat *string) (bool, []error) {
+	var errors []error
+	result := ar.db.Model(&models.MessageAttachment{}).
+		Where("id = ? AND scan_status = ?", attachmentID, enums.ATTACHMENT_SCAN_STATUS_PENDING).
+		Updates(map[string]interface{}{
+			"scan_status": status,
+			"scan_threat": threat,
+			"scanned_at":  time.Now(),
+		})
+	if err := result.Error; err != nil {
+		errors = append(errors, err)
+		return false, errors
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// RecordScanFailure counts a failed scan of a pending attachment and marks it failed once the failures
+// reach maxAttempts. It returns true if the attachment was marked failed.
+func (ar *AttachmentRepository) RecordScanFailure(attachmentID uint, maxAttempts int) (bool, []error) {
+	var errors []error
+	var attachment models.MessageAttachment
+	result := ar.db.Model(&attachment).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "scan_status"}}}).
+		Where("id = ? AND scan_status = ?", attachmentID, enums.ATTACHMENT_SCAN_STATUS_PENDING).
+		Updates(map[string]interface{}{
+			"scan_attempts": gorm.Expr("scan_attempts + 1"),
+			"scan_status":   gorm.Expr("CASE WHEN scan_attempts + 1 >= ? THEN ? ELSE scan_status END", maxAttempts, enums.ATTACHMENT_SCAN_STATUS_FAILED),
+			"scanned_at":    gorm.Expr("CASE WHEN scan_attempts + 1 >= ? THEN ? ELSE scanned_at END", maxAttempts, time.Now()),
+		})
+	if err := result.Error; err != nil {
+		errors = append(errors, err)
+		return false, errors
+	}
+	return result.RowsAffected > 0 && attachment.ScanStatus == enums.ATTACHMENT_SCAN_STATUS_FAILED, nil
+}
+
+// GetPendingScans returns attachments created before the given time that are still waiting for a scan,
+// after the given ID
+func (ar *AttachmentRepository) GetPendingScans(createdBefore time.Time, afterID uint, limit int) ([]models.MessageAttachment, []error) {
+	var errors []error
+	var attachments []models.MessageAttachment
+	if err := ar.db.
+		Where("scan_status = ? AND created_at < ? AND id > ?", enums.ATTACHMENT_SCAN_STATUS_PENDING, createdBefore, afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&attachments).Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return attachments, nil
+}
+
+// GetObjectKeys returns the keys of the files of the bucket attachments refer to, thumbnails included
+func (ar *AttachmentRepository) GetObjectKeys(bucket string) ([]string, []error) {
+	var errors []error
+	var keys, variantKeys []string
+	if err := ar.db.Unscoped().Model(&models.MessageAttachment{}).Where("bucket = ?", bucket).Distinct().Pluck("object_key", &keys).Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	if err := ar.db.Unscoped().Model(&models.AttachmentVariant{}).
+		Joins("JOIN message_attachments ON message_attachments.id = attachment_variants.attachment_id").
+		Where("message_attachments.bucket = ?", bucket).
+		Pluck("attachment_variants.object_key", &variantKeys).Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return append(keys, variantKeys...), nil
+}
+
+// GetAbandonedAttachments returns attachments created before the given time that were never sent, after the given ID
+func (ar *AttachmentRepository) GetAbandonedAttachments(createdBefore time.Time, afterID uint, limit int) ([]models.MessageAttachment, []error) {
+	var errors []error
+	var attachments []models.MessageAttachment
+	if err := ar.db.
+		Where("message_id IS NULL AND created_at < ? AND id > ?", createdBefore, afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&attachments).Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return attachments, nil
+}
+
+// DeleteAbandonedAttachment deletes an attachment with its variants unless it was sent in the meantime.
+// Their files are left to the caller.
+func (ar *AttachmentRepository) DeleteAbandonedAttachment(attachmentID uint) []error {
+	var errors []error
+	transactionErr := ar.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("id = ? AND message_id IS NULL", attachmentID).Delete(&models.MessageAttachment{})
+		if err := result.Error; err != nil {
+			return err
+		}
+		if result.RowsAffected == 0 {
+			return errs.ErrAttachmentNotFound
+		}
+		return tx.Unscoped().Where("attachment_id = ?", attachmentID).Delete(&models.AttachmentVariant{}).Error
+	})
+	if transactionErr != nil {
+		errors = append(errors, transactionErr)
+		return errors
+	}
+	return nil
+}
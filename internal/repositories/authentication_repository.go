@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type AuthenticationRepository struct {
@@ -118,18 +119,55 @@ func (ar *AuthenticationRepository) GetSingleUser(id int) (*models.UserResponse,
 	return user.ToUserResponse(), nil
 }
 
-func (ar *AuthenticationRepository) UpdateUserProfilePhoto(id uint, photo string) []error {
+// UpdateUserProfilePhoto replaces the profile photo of the user and returns the replaced one
+func (ar *AuthenticationRepository) UpdateUserProfilePhoto(id uint, photo *models.ProfilePhotoResponse) (*models.ProfilePhotoResponse, []error) {
 	var errors []error
-	result := ar.db.Model(&models.User{}).Where("id = ?", id).Update("profile_photo", photo)
-	if err := result.Error; err != nil {
+	var user models.User
+	transactionErr := ar.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).Limit(1).Find(&user)
+		if err := result.Error; err != nil {
+			return err
+		}
+		if result.RowsAffected == 0 {
+			return errs.ErrUserNotFound
+		}
+		return tx.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"profile_photo":           photo.ProfilePhoto,
+			"profile_photo_thumbnail": photo.ProfilePhotoThumbnail,
+			"profile_photo_blurhash":  photo.ProfilePhotoBlurhash,
+		}).Error
+	})
+	if transactionErr != nil {
+		errors = append(errors, transactionErr)
+		return nil, errors
+	}
+
+	previous := &models.ProfilePhotoResponse{}
+	if user.ProfilePhoto != nil {
+		previous.ProfilePhoto = *user.ProfilePhoto
+	}
+	if user.ProfilePhotoThumbnail != nil {
+		previous.ProfilePhotoThumbnail = *user.ProfilePhotoThumbnail
+	}
+	if user.ProfilePhotoBlurhash != nil {
+		previous.ProfilePhotoBlurhash = *user.ProfilePhotoBlurhash
+	}
+	return previous, nil
+}
+
+// GetProfilePhotoUrls returns the URLs of the profile photos and thumbnails of every user
+func (ar *AuthenticationRepository) GetProfilePhotoUrls() ([]string, []error) {
+	var errors []error
+	var photos, thumbnails []string
+	if err := ar.db.Unscoped().Model(&models.User{}).Where("profile_photo IS NOT NULL").Pluck("profile_photo", &photos).Error; err != nil {
 		errors = append(errors, err)
-		return errors
+		return nil, errors
 	}
-	if result.RowsAffected == 0 {
-		errors = append(errors, errs.ErrUserNotFound)
-		return errors
+	if err := ar.db.Unscoped().Model(&models.User{}).Where("profile_photo_thumbnail IS NOT NULL").Pluck("profile_photo_thumbnail", &thumbnails).Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
 	}
-	return nil
+	return append(photos, thumbnails...), nil
 }
 
 func (ar *AuthenticationRepository) UpdateUser(updateUserReq *models.UpdateUserRequest) (*models.ProfileResponse, []error) {
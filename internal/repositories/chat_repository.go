@@ -2,6 +2,8 @@ package repositories
 
 import (
 	"log"
+	"slices"
+	"socketChat/internal/enums"
 	"socketChat/internal/errs"
 	"socketChat/internal/models"
 	"socketChat/internal/utils"
@@ -9,6 +11,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ChatRepository struct {
@@ -113,12 +116,56 @@ func (chr *ChatRepository) GetUserConversations(userID uint, page, size int) (*m
 	}, nil
 }
 
-func (chr *ChatRepository) SaveMessage(message *models.Message) (*models.Message, []error) {
+// SaveMessage stores a new message with the given attachments of its sender, charging them to the
+// conversation within its quota, 0 meaning unlimited. A message the sender already sent with
+// the same client ID is not stored twice, the original one is returned instead and reported as a duplicate.
+func (chr *ChatRepository) SaveMessage(message *models.Message, attachmentIds []uint, conversationQuota int64) (*models.Message, bool, []error) {
 	var errors []error
+	duplicate := false
 	transactionErr := chr.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(message).Error; err != nil {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(message)
+		if err := result.Error; err != nil {
 			return err
 		}
+		if result.RowsAffected == 0 && message.ClientID != nil {
+			original := models.Message{}
+			if err := tx.Unscoped().
+				Preload("Attachments").
+				Preload("Attachments.Variants", orderVariants).
+				Where("sender_id = ? AND client_id = ?", message.SenderID, *message.ClientID).
+				First(&original).Error; err != nil {
+				return err
+			}
+			original.Tombstone()
+			original.ConcealAttachments(0)
+			*message = original
+			duplicate = true
+			return nil
+		}
+		if len(attachmentIds) > 0 {
+			// Attachments can only be sent once, by the user who uploaded them, and never once quarantined
+			result := tx.Model(&models.MessageAttachment{}).
+				Where("id IN ? AND uploader_id = ? AND message_id IS NULL AND scan_status <> ?", attachmentIds, message.SenderID, enums.ATTACHMENT_SCAN_STATUS_QUARANTINED).
+				Update("message_id", message.ID)
+			if err := result.Error; err != nil {
+				return err
+			}
+			if result.RowsAffected != int64(len(attachmentIds)) {
+				return errs.ErrInvalidAttachment
+			}
+			if err := tx.Preload("Variants", orderVariants).Where("message_id = ?", message.ID).Order("id ASC").Find(&message.Attachments).Error; err != nil {
+				return err
+			}
+			var size int64
+			for _, attachment := range message.Attachments {
+				size += attachment.Size
+			}
+			if err := chargeUsage(tx, enums.STORAGE_OWNER_TYPE_CONVERSATION, message.ConversationID, size, int64(len(message.Attachments)), conversationQuota); err != nil {
+				return err
+			}
+			// The message is broadcast as is, attachments still being scanned are revealed by attachment_scanned events
+			message.ConcealAttachments(0)
+		}
 		if err := tx.Model(&models.Conversation{}).
 			Where("id = ?", message.ConversationID).
 			Update("updated_at", time.Now()).Error; err != nil {
@@ -128,38 +175,133 @@ func (chr *ChatRepository) SaveMessage(message *models.Message) (*models.Message
 	})
 	if transactionErr != nil {
 		errors = append(errors, transactionErr)
+		return nil, false, errors
+	}
+	return message, duplicate, nil
+}
+
+func (chr *ChatRepository) GetMessageById(messageID uint) (*models.Message, []error) {
+	var errors []error
+	var message models.Message
+	result := chr.db.Where("id = ?", messageID).Limit(1).Find(&message)
+	if err := result.Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	if result.RowsAffected == 0 {
+		errors = append(errors, errs.ErrMessageNotFound)
 		return nil, errors
 	}
-	return message, nil
+	return &message, nil
+}
+
+// EditMessage replaces the message content and keeps the previous one as a revision.
+// Only the sender of the message can edit it, while still a member of its conversation.
+func (chr *ChatRepository) EditMessage(messageID, editorID uint, content string) (*models.Message, []error) {
+	var errors []error
+	var message models.Message
+	transactionErr := chr.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ?", messageID).Limit(1).Find(&message)
+		if err := result.Error; err != nil {
+			return err
+		}
+		if result.RowsAffected == 0 {
+			return errs.ErrMessageNotFound
+		}
+		if message.SenderID != editorID {
+			return errs.ErrNotMessageSender
+		}
+		// Senders that left the conversation can no longer edit their messages
+		if !chr.CheckUserInConversation(editorID, message.ConversationID) {
+			return errs.ErrMessageNotFound
+		}
+		if err := tx.Create(&models.MessageEdit{
+			MessageID: message.ID,
+			Content:   message.Content,
+		}).Error; err != nil {
+			return err
+		}
+		editedAt := time.Now()
+		if err := tx.Model(&message).Updates(map[string]any{
+			"content":   content,
+			"edited_at": editedAt,
+		}).Error; err != nil {
+			return err
+		}
+		message.Content = content
+		message.EditedAt = &editedAt
+		return nil
+	})
+	if transactionErr != nil {
+		errors = append(errors, transactionErr)
+		return nil, errors
+	}
+	return &message, nil
+}
+
+func (chr *ChatRepository) GetMessageEdits(messageID uint) ([]models.MessageEdit, []error) {
+	var errors []error
+	var edits []models.MessageEdit
+	if err := chr.db.
+		Where("message_id = ?", messageID).
+		Order("created_at ASC").
+		Find(&edits).Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return edits, nil
 }
 
 func (chr *ChatRepository) GetConversationLastMessage(conversationID uint) (*models.Message, error) {
 	var message models.Message
 	if err := chr.db.
-		Where("conversation_id = ?", conversationID).
+		Where("conversation_id = ? AND thread_root_id IS NULL", conversationID).
 		Last(&message).Error; err != nil {
 		return nil, err
 	}
 	return &message, nil
 }
 
-func (chr *ChatRepository) GetMessagesByConversationId(conversationID uint, page, size int) (*models.MessageListResponse, []error) {
+// GetMessagesByConversationId returns the main timeline of the conversation as seen by the user,
+// thread replies are listed under their root by GetThreadMessages.
+func (chr *ChatRepository) GetMessagesByConversationId(conversationID, userID uint, page, size int) (*models.MessageListResponse, []error) {
+	return chr.getMessages(func(db *gorm.DB) *gorm.DB {
+		return db.Where("conversation_id = ? AND thread_root_id IS NULL", conversationID)
+	}, userID, page, size)
+}
+
+func (chr *ChatRepository) GetThreadMessages(threadRootID, userID uint, page, size int) (*models.MessageListResponse, []error) {
+	return chr.getMessages(func(db *gorm.DB) *gorm.DB {
+		return db.Where("thread_root_id = ?", threadRootID)
+	}, userID, page, size)
+}
+
+// getMessages lists the messages matched by scope as seen by the user.
+// Messages deleted for everyone are returned as tombstones, messages the user deleted for themselves are left out.
+func (chr *ChatRepository) getMessages(scope func(db *gorm.DB) *gorm.DB, userID uint, page, size int) (*models.MessageListResponse, []error) {
 	var errors []error
 	var messages []models.Message
 	var total int64
 
 	transactionErr := chr.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.
-			Scopes(utils.Paginate(page, size)).
-			Where("conversation_id = ?", conversationID).
+			Unscoped().
+			Preload("Attachments", func(db *gorm.DB) *gorm.DB {
+				return db.Order("id ASC")
+			}).
+			Preload("Attachments.Variants", orderVariants).
+			Scopes(scope, utils.Paginate(page, size)).
+			Where("id NOT IN (SELECT message_id FROM hidden_messages WHERE user_id = ? AND deleted_at IS NULL)", userID).
 			Order("created_at DESC").
 			Find(&messages).Error; err != nil {
 			return err
 		}
 
 		if err := tx.
+			Unscoped().
 			Model(&models.Message{}).
-			Where("conversation_id = ?", conversationID).
+			Scopes(scope).
+			Where("id NOT IN (SELECT message_id FROM hidden_messages WHERE user_id = ? AND deleted_at IS NULL)", userID).
 			Count(&total).Error; err != nil {
 			return err
 		}
@@ -171,6 +313,31 @@ func (chr *ChatRepository) GetMessagesByConversationId(conversationID uint, page
 		return nil, errors
 	}
 
+	for i := range messages {
+		messages[i].Tombstone()
+		messages[i].ConcealAttachments(userID)
+	}
+
+	if err := chr.attachReplyPreviews(messages); err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+
+	if err := chr.attachReactionSummaries(messages, userID); err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+
+	if err := chr.attachThreadSummaries(messages, userID); err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+
+	if err := chr.attachReadReceipts(messages); err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+
 	return &models.MessageListResponse{
 		Messages: messages,
 		Page:     page,
@@ -179,6 +346,300 @@ func (chr *ChatRepository) GetMessagesByConversationId(conversationID uint, page
 	}, nil
 }
 
+// attachThreadSummaries sets the reply count, last reply time and the user's unread replies on thread roots
+func (chr *ChatRepository) attachThreadSummaries(messages []models.Message, userID uint) error {
+	var messageIds []uint
+	for _, message := range messages {
+		if message.ThreadRootID == nil {
+			messageIds = append(messageIds, message.ID)
+		}
+	}
+	if len(messageIds) == 0 {
+		return nil
+	}
+
+	var summaries []models.ThreadSummary
+	if err := chr.db.Raw(
+		`SELECT thread_root_id, COUNT(*) AS reply_count, MAX(created_at) AS last_reply_at,
+			COUNT(*) FILTER (WHERE sender_id <> ? AND NOT EXISTS (
+				SELECT 1 FROM message_reads WHERE message_reads.message_id = messages.id AND message_reads.user_id = ?
+			)) AS unread_count
+		FROM messages
+		WHERE thread_root_id IN ? AND deleted_at IS NULL
+		GROUP BY thread_root_id`,
+		userID,
+		userID,
+		messageIds,
+	).Scan(&summaries).Error; err != nil {
+		return err
+	}
+
+	threads := make(map[uint]*models.ThreadSummary, len(summaries))
+	for i := range summaries {
+		threads[summaries[i].ThreadRootID] = &summaries[i]
+	}
+	for i := range messages {
+		messages[i].Thread = threads[messages[i].ID]
+	}
+	return nil
+}
+
+// attachReadReceipts tells for every message how many of the other members got and read it, and who read it
+func (chr *ChatRepository) attachReadReceipts(messages []models.Message) error {
+	var messageIds, conversationIds []uint
+	for _, message := range messages {
+		if !message.IsDeleted {
+			messageIds = append(messageIds, message.ID)
+			if !slices.Contains(conversationIds, message.ConversationID) {
+				conversationIds = append(conversationIds, message.ConversationID)
+			}
+		}
+	}
+	if len(messageIds) == 0 {
+		return nil
+	}
+
+	var memberCounts []struct {
+		ConversationID uint
+		Count          int
+	}
+	if err := chr.db.
+		Model(&models.ConversationMember{}).
+		Select("conversation_id, COUNT(*) AS count").
+		Where("conversation_id IN ?", conversationIds).
+		Group("conversation_id").
+		Scan(&memberCounts).Error; err != nil {
+		return err
+	}
+	members := make(map[uint]int, len(memberCounts))
+	for _, memberCount := range memberCounts {
+		members[memberCount.ConversationID] = memberCount.Count
+	}
+
+	var reads []models.MessageRead
+	if err := chr.db.
+		Where("message_id IN ?", messageIds).
+		Order("read_at ASC").
+		Find(&reads).Error; err != nil {
+		return err
+	}
+	readers := make(map[uint][]models.MessageReader)
+	for _, read := range reads {
+		readers[read.MessageID] = append(readers[read.MessageID], models.MessageReader{
+			UserID: read.UserID,
+			ReadAt: read.ReadAt,
+		})
+	}
+
+	var deliveryCounts []struct {
+		MessageID uint
+		Count     int
+	}
+	if err := chr.db.
+		Model(&models.MessageDelivery{}).
+		Select("message_id, COUNT(*) AS count").
+		Where("message_id IN ?", messageIds).
+		Group("message_id").
+		Scan(&deliveryCounts).Error; err != nil {
+		return err
+	}
+	deliveries := make(map[uint]int, len(deliveryCounts))
+	for _, deliveryCount := range deliveryCounts {
+		deliveries[deliveryCount.MessageID] = deliveryCount.Count
+	}
+
+	for i := range messages {
+		if messages[i].IsDeleted {
+			continue
+		}
+		messageReaders := readers[messages[i].ID]
+		if messageReaders == nil {
+			messageReaders = []models.MessageReader{}
+		}
+		messages[i].ReadReceipt = &models.ReadReceipt{
+			DeliveredCount: deliveries[messages[i].ID],
+			SeenCount:      len(messageReaders),
+			// The sender doesn't read their own message
+			MemberCount: max(members[messages[i].ConversationID]-1, 0),
+			Readers:     messageReaders,
+		}
+		messages[i].ReadReceipt.ResolveStatus()
+	}
+	return nil
+}
+
+// attachReplyPreviews loads the messages quoted by the given ones, deleted ones included, in a single query
+func (chr *ChatRepository) attachReplyPreviews(messages []models.Message) error {
+	var replyToIds []uint
+	for _, message := range messages {
+		if message.ReplyToID != nil {
+			replyToIds = append(replyToIds, *message.ReplyToID)
+		}
+	}
+	if len(replyToIds) == 0 {
+		return nil
+	}
+
+	var quotedMessages []models.Message
+	if err := chr.db.Unscoped().Where("id IN ?", replyToIds).Find(&quotedMessages).Error; err != nil {
+		return err
+	}
+	previews := make(map[uint]*models.MessagePreview, len(quotedMessages))
+	for _, quoted := range quotedMessages {
+		previews[quoted.ID] = quoted.ToMessagePreview()
+	}
+	for i := range messages {
+		if messages[i].ReplyToID != nil {
+			messages[i].ReplyTo = previews[*messages[i].ReplyToID]
+		}
+	}
+	return nil
+}
+
+// attachReactionSummaries aggregates the reactions of the given messages per emoji, in order of first use
+func (chr *ChatRepository) attachReactionSummaries(messages []models.Message, userID uint) error {
+	var messageIds []uint
+	for _, message := range messages {
+		if !message.IsDeleted {
+			messageIds = append(messageIds, message.ID)
+		}
+	}
+	if len(messageIds) == 0 {
+		return nil
+	}
+
+	var summaries []models.ReactionSummary
+	if err := chr.db.Raw(
+		`SELECT message_id, emoji, COUNT(*) AS count, BOOL_OR(user_id = ?) AS reacted_by_me
+		FROM message_reactions
+		WHERE message_id IN ? AND deleted_at IS NULL
+		GROUP BY message_id, emoji
+		ORDER BY MIN(created_at)`,
+		userID,
+		messageIds,
+	).Scan(&summaries).Error; err != nil {
+		return err
+	}
+
+	reactions := make(map[uint][]models.ReactionSummary)
+	for _, summary := range summaries {
+		reactions[summary.MessageID] = append(reactions[summary.MessageID], summary)
+	}
+	for i := range messages {
+		messages[i].Reactions = reactions[messages[i].ID]
+	}
+	return nil
+}
+
+func (chr *ChatRepository) AddReaction(reaction *models.MessageReaction) []error {
+	var errors []error
+	// Reacting twice with the same emoji is a no-op
+	if err := chr.db.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(reaction).Error; err != nil {
+		errors = append(errors, err)
+		return errors
+	}
+	return nil
+}
+
+func (chr *ChatRepository) RemoveReaction(messageID, userID uint, emoji string) []error {
+	var errors []error
+	// Hard delete so the same reaction can be added again
+	if err := chr.db.
+		Unscoped().
+		Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).
+		Delete(&models.MessageReaction{}).Error; err != nil {
+		errors = append(errors, err)
+		return errors
+	}
+	return nil
+}
+
+// DeleteMessageForEveryone soft deletes the message and deletes its attachments, which it returns.
+// Only the sender can do it, and only within window after sending unless window is 0.
+func (chr *ChatRepository) DeleteMessageForEveryone(messageID, deleterID uint, window time.Duration) (*models.Message, []models.MessageAttachment, []error) {
+	var errors []error
+	var message models.Message
+	var attachments []models.MessageAttachment
+	transactionErr := chr.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ?", messageID).Limit(1).Find(&message)
+		if err := result.Error; err != nil {
+			return err
+		}
+		if result.RowsAffected == 0 {
+			return errs.ErrMessageNotFound
+		}
+		if message.SenderID != deleterID {
+			return errs.ErrNotMessageSender
+		}
+		if window > 0 && time.Since(message.CreatedAt) > window {
+			return errs.ErrDeleteWindowExpired
+		}
+		deletedAt := time.Now()
+		if err := tx.Model(&message).Update("deleted_at", deletedAt).Error; err != nil {
+			return err
+		}
+		message.DeletedAt = gorm.DeletedAt{Time: deletedAt, Valid: true}
+		return deleteMessageAttachments(tx, &message, &attachments)
+	})
+	if transactionErr != nil {
+		errors = append(errors, transactionErr)
+		return nil, nil, errors
+	}
+	message.Tombstone()
+	return &message, attachments, nil
+}
+
+// deleteMessageAttachments deletes the attachments of the message with their variants, and refunds them
+// to its conversation. Variant files may still be shared with attachments of the same stored file,
+// the garbage collector removes the ones nothing refers to anymore. The stored files of the attachments
+// are left to the caller.
+func deleteMessageAttachments(tx *gorm.DB, message *models.Message, attachments *[]models.MessageAttachment) error {
+	if err := tx.Where("message_id = ?", message.ID).Find(attachments).Error; err != nil {
+		return err
+	}
+	if len(*attachments) == 0 {
+		return nil
+	}
+	var size int64
+	attachmentIds := make([]uint, 0, len(*attachments))
+	for _, attachment := range *attachments {
+		size += attachment.Size
+		attachmentIds = append(attachmentIds, attachment.ID)
+	}
+	if err := tx.Unscoped().Where("attachment_id IN ?", attachmentIds).Delete(&models.AttachmentVariant{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("id IN ?", attachmentIds).Delete(&models.MessageAttachment{}).Error; err != nil {
+		return err
+	}
+	return chargeUsage(tx, enums.STORAGE_OWNER_TYPE_CONVERSATION, message.ConversationID, -size, -int64(len(*attachments)), 0)
+}
+
+// HideMessage deletes the message for the user only. The user must be a member of its conversation.
+func (chr *ChatRepository) HideMessage(messageID, userID uint) []error {
+	var errors []error
+	message, getMessageErrs := chr.GetMessageById(messageID)
+	if len(getMessageErrs) > 0 {
+		return getMessageErrs
+	}
+	if !chr.CheckUserInConversation(userID, message.ConversationID) {
+		errors = append(errors, errs.ErrMessageNotFound)
+		return errors
+	}
+	if err := chr.db.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.HiddenMessage{
+			MessageID: messageID,
+			UserID:    userID,
+		}).Error; err != nil {
+		errors = append(errors, err)
+		return errors
+	}
+	return nil
+}
+
 func (chr *ChatRepository) CheckConversationExists(conversationID uint) bool {
 	var count int64
 	chr.db.Model(&models.Conversation{}).Where("id = ?", conversationID).Count(&count)
@@ -191,27 +652,171 @@ func (chr *ChatRepository) CheckUserInConversation(userID, conversationID uint)
 	return count > 0
 }
 
-func (chr *ChatRepository) SeenMessage(messageIds []uint, seenerId uint) []error {
+// SeenMessage records that the seener read the messages of the conversation. Messages sent by the seener,
+// messages of other conversations and messages of conversations the seener is not a member of are skipped.
+// The read cursors of the seener move forward to the latest main timeline message seen.
+func (chr *ChatRepository) SeenMessage(conversationId uint, messageIds []uint, seenerId uint) []error {
 	var errors []error
-	// Update if not seen yet and sender is not the seener to prevent message owner from marking it as seen
-	result := chr.db.Model(&models.Message{}).Where("id IN ? AND seen_at IS NULL AND sender_id != ?", messageIds, seenerId).Update("seen_at", time.Now())
-	if err := result.Error; err != nil {
-		errors = append(errors, err)
+	var rowsAffected int64
+	transactionErr := chr.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Exec(
+			`INSERT INTO message_reads (created_at, updated_at, message_id, user_id, read_at)
+			SELECT ?, ?, messages.id, ?, ?
+			FROM messages
+			INNER JOIN conversation_members ON conversation_members.conversation_id = messages.conversation_id
+				AND conversation_members.user_id = ? AND conversation_members.deleted_at IS NULL
+			WHERE messages.id IN ? AND messages.conversation_id = ? AND messages.sender_id <> ? AND messages.deleted_at IS NULL
+			ON CONFLICT DO NOTHING`,
+			now, now, seenerId, now, seenerId, messageIds, conversationId, seenerId,
+		)
+		if err := result.Error; err != nil {
+			return err
+		}
+		rowsAffected = result.RowsAffected
+		// Unread counts come from the read cursors
+		if err := tx.Exec(
+			`UPDATE conversation_members SET last_read_message_id = seen.message_id, last_read_at = ?
+			FROM (
+				SELECT conversation_id, MAX(id) AS message_id FROM messages
+				WHERE id IN ? AND conversation_id = ? AND sender_id <> ? AND thread_root_id IS NULL AND deleted_at IS NULL
+				GROUP BY conversation_id
+			) AS seen
+			WHERE conversation_members.conversation_id = seen.conversation_id AND conversation_members.user_id = ?
+				AND conversation_members.deleted_at IS NULL AND conversation_members.last_read_message_id < seen.message_id`,
+			now, messageIds, conversationId, seenerId, seenerId,
+		).Error; err != nil {
+			return err
+		}
+		// seen_at keeps telling when the message was first seen by anyone
+		return tx.Model(&models.Message{}).
+			Where("id IN ? AND conversation_id = ? AND seen_at IS NULL AND sender_id != ?", messageIds, conversationId, seenerId).
+			Where("id IN (SELECT message_id FROM message_reads WHERE user_id = ?)", seenerId).
+			Update("seen_at", now).Error
+	})
+	if transactionErr != nil {
+		errors = append(errors, transactionErr)
 		return errors
 	}
-	if result.RowsAffected == 0 {
+	if rowsAffected == 0 {
 		errors = append(errors, errs.NoneOfMessagesSeen)
 		return errors
 	}
 	return nil
 }
 
+// RecordDeliveries records that the messages reached one of the recipient's devices.
+// Messages sent by the recipient, deleted ones and ones already delivered to them are skipped,
+// only the new deliveries are returned, with their messages.
+func (chr *ChatRepository) RecordDeliveries(messageIds []uint, recipientId uint) ([]models.MessageDelivery, []error) {
+	var errors []error
+	var deliveryIds []uint
+	now := time.Now()
+	if err := chr.db.Raw(
+		`INSERT INTO message_deliveries (created_at, updated_at, message_id, user_id, delivered_at)
+		SELECT ?, ?, messages.id, ?, ?
+		FROM messages
+		INNER JOIN conversation_members ON conversation_members.conversation_id = messages.conversation_id
+			AND conversation_members.user_id = ? AND conversation_members.deleted_at IS NULL
+		WHERE messages.id IN ? AND messages.sender_id <> ? AND messages.deleted_at IS NULL
+		ON CONFLICT DO NOTHING
+		RETURNING id`,
+		now, now, recipientId, now, recipientId, messageIds, recipientId,
+	).Scan(&deliveryIds).Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	if len(deliveryIds) == 0 {
+		return nil, nil
+	}
+	var deliveries []models.MessageDelivery
+	if err := chr.db.Preload("Message").Where("id IN ?", deliveryIds).Find(&deliveries).Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return deliveries, nil
+}
+
+// MarkReadUpTo advances the member's read cursor to the message and records the reads of every
+// main timeline message it passes, so receipts stay per message. The cursor never moves back,
+// the returned bool tells whether it moved.
+func (chr *ChatRepository) MarkReadUpTo(conversationID, userID, messageID uint) (bool, []error) {
+	var errors []error
+	advanced := false
+	transactionErr := chr.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Message{}).
+			Where("id = ? AND conversation_id = ? AND thread_root_id IS NULL", messageID, conversationID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return errs.ErrInvalidReadPosition
+		}
+
+		now := time.Now()
+		result := tx.Model(&models.ConversationMember{}).
+			Where("conversation_id = ? AND user_id = ? AND last_read_message_id < ?", conversationID, userID, messageID).
+			Updates(map[string]any{
+				"last_read_message_id": messageID,
+				"last_read_at":         now,
+			})
+		if err := result.Error; err != nil {
+			return err
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		advanced = true
+
+		return tx.Exec(
+			`INSERT INTO message_reads (created_at, updated_at, message_id, user_id, read_at)
+			SELECT ?, ?, id, ?, ?
+			FROM messages
+			WHERE conversation_id = ? AND id <= ? AND sender_id <> ? AND thread_root_id IS NULL AND deleted_at IS NULL
+			ON CONFLICT DO NOTHING`,
+			now, now, userID, now, conversationID, messageID, userID,
+		).Error
+	})
+	if transactionErr != nil {
+		errors = append(errors, transactionErr)
+		return false, errors
+	}
+	return advanced, nil
+}
+
 func (chr *ChatRepository) GetConversationUnReadMessagesForUser(conversationID, userID uint) (int, error) {
 	var count int = 0
 	result := chr.db.Raw(
-		"SELECT COUNT(*) FROM messages WHERE conversation_id = ? AND sender_id <> ? AND seen_at IS NULL",
+		`SELECT COUNT(*) FROM messages
+		WHERE conversation_id = ? AND sender_id <> ? AND deleted_at IS NULL AND thread_root_id IS NULL
+		AND id > COALESCE((
+			SELECT last_read_message_id FROM conversation_members
+			WHERE conversation_id = ? AND user_id = ? AND deleted_at IS NULL
+		), 0)`,
 		conversationID,
 		userID,
+		conversationID,
+		userID,
+	).Scan(&count)
+
+	if err := result.Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Thread replies are outside the read cursor, they are read one by one from the thread panel
+func (chr *ChatRepository) GetThreadUnReadMessagesForUser(threadRootID, userID uint) (int, error) {
+	var count int = 0
+	result := chr.db.Raw(
+		`SELECT COUNT(*) FROM messages
+		WHERE thread_root_id = ? AND sender_id <> ? AND deleted_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM message_reads WHERE message_reads.message_id = messages.id AND message_reads.user_id = ?)`,
+		threadRootID,
+		userID,
+		userID,
 	).Scan(&count)
 
 	if err := result.Error; err != nil {
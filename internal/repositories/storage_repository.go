@@ -0,0 +1,183 @@
+package repositories
+
+import (
+	"socketChat/internal/enums"
+	"socketChat/internal/errs"
+	"socketChat/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StorageRepository struct {
+	db *gorm.DB
+}
+
+func NewStorageRepository(db *gorm.DB) *StorageRepository {
+	return &StorageRepository{
+		db: db,
+	}
+}
+
+// AcquireObject charges the size of the object to the owner within the quota, 0 meaning unlimited,
+// then references the stored object of the same content or creates it without a URL.
+// The file is uploaded with upload outside of any transaction by whoever finds the object without
+// a URL, or as its only reference: its creator, uploads of the same content racing it, the next one
+// after a failed upload, and the first one after the last reference was dropped, whose file may be
+// gone already. They all write the same content under the same key.
+func (sr *StorageRepository) AcquireObject(object *models.StoredObject, ownerID uint, quota int64, upload func() (string, error)) (*models.StoredObject, []error) {
+	var errors []error
+	if err := chargeUsage(sr.db, enums.STORAGE_OWNER_TYPE_USER, ownerID, object.Size, 1, quota); err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	object.RefCount = 1
+	if err := sr.db.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "bucket"}, {Name: "hash"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"ref_count": gorm.Expr("stored_objects.ref_count + 1"),
+			}),
+		},
+		clause.Returning{},
+	).Create(object).Error; err != nil {
+		errors = append(errors, err)
+		if err := chargeUsage(sr.db, enums.STORAGE_OWNER_TYPE_USER, ownerID, -object.Size, -1, 0); err != nil {
+			errors = append(errors, err)
+		}
+		return nil, errors
+	}
+	if object.URL != "" && object.RefCount > 1 {
+		return object, nil
+	}
+
+	url, err := upload()
+	if err == nil {
+		err = sr.db.Model(object).Update("url", url).Error
+	}
+	if err != nil {
+		errors = append(errors, err)
+		// The reference is dropped and refunded. A file left without any reference, uploaded by
+		// this upload or a racing one, is removed by the garbage collector.
+		return nil, append(errors, sr.ReleaseObject(ownerID, object.Bucket, object.ObjectKey, func() error { return nil })...)
+	}
+	object.URL = url
+	return object, nil
+}
+
+// ReleaseObject drops a reference of the owner to the stored object and refunds its size.
+// The last reference removes the object, and its file with remove once the release is committed.
+func (sr *StorageRepository) ReleaseObject(ownerID uint, bucket string, objectKey string, remove func() error) []error {
+	var errors []error
+	var object models.StoredObject
+	transactionErr := sr.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&object).
+			Clauses(clause.Returning{}).
+			Where("bucket = ? AND object_key = ? AND ref_count > 0", bucket, objectKey).
+			Update("ref_count", gorm.Expr("ref_count - 1"))
+		if err := result.Error; err != nil {
+			return err
+		}
+		if result.RowsAffected == 0 {
+			return errs.ErrFileNotFound
+		}
+		return chargeUsage(tx, enums.STORAGE_OWNER_TYPE_USER, ownerID, -object.Size, -1, 0)
+	})
+	if transactionErr != nil {
+		errors = append(errors, transactionErr)
+		return errors
+	}
+	if object.RefCount > 0 {
+		return nil
+	}
+
+	// The row stays locked while the file is removed, so uploads of the same content wait for the
+	// removal and store their file again. If the file is removed but the row is not, the row is left
+	// without references and the next upload of the content stores its file again as well.
+	transactionErr = sr.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND ref_count = 0", object.ID).
+			Limit(1).
+			Find(&object)
+		if err := result.Error; err != nil {
+			return err
+		}
+		// Referenced again in the meantime
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		if err := remove(); err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&object).Error
+	})
+	if transactionErr != nil {
+		errors = append(errors, transactionErr)
+		return errors
+	}
+	return nil
+}
+
+func (sr *StorageRepository) GetStoredObjectByUrl(bucket string, url string) (*models.StoredObject, []error) {
+	var errors []error
+	var object models.StoredObject
+	result := sr.db.Where("bucket = ? AND url = ?", bucket, url).Limit(1).Find(&object)
+	if err := result.Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	if result.RowsAffected == 0 {
+		errors = append(errors, errs.ErrFileNotFound)
+		return nil, errors
+	}
+	return &object, nil
+}
+
+// GetUsage returns the usage of the owner, empty if nothing was charged to it yet
+func (sr *StorageRepository) GetUsage(ownerType string, ownerID uint) (*models.StorageUsage, []error) {
+	var errors []error
+	usage := models.StorageUsage{OwnerType: ownerType, OwnerID: ownerID}
+	if err := sr.db.Where("owner_type = ? AND owner_id = ?", ownerType, ownerID).Limit(1).Find(&usage).Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return &usage, nil
+}
+
+// chargeUsage adds bytes and files to the usage of the owner, failing if it would exceed the quota.
+// Refunds are negative charges and never fail on the quota.
+func chargeUsage(db *gorm.DB, ownerType string, ownerID uint, bytes int64, files int64, quota int64) error {
+	usage := models.StorageUsage{OwnerType: ownerType, OwnerID: ownerID}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&usage).Error; err != nil {
+		return err
+	}
+	query := db.Model(&models.StorageUsage{}).Where("owner_type = ? AND owner_id = ?", ownerType, ownerID)
+	if quota > 0 && bytes > 0 {
+		query = query.Where("used_bytes + ? <= ?", bytes, quota)
+	}
+	result := query.Updates(map[string]interface{}{
+		"used_bytes": gorm.Expr("GREATEST(used_bytes + ?, 0)", bytes),
+		"file_count": gorm.Expr("GREATEST(file_count + ?, 0)", files),
+	})
+	if err := result.Error; err != nil {
+		return err
+	}
+	if result.RowsAffected == 0 {
+		if ownerType == enums.STORAGE_OWNER_TYPE_CONVERSATION {
+			return errs.ErrConversationQuotaExceeded
+		}
+		return errs.ErrStorageQuotaExceeded
+	}
+	return nil
+}
+
+// GetObjectKeys returns the keys of the stored objects of the bucket
+func (sr *StorageRepository) GetObjectKeys(bucket string) ([]string, []error) {
+	var errors []error
+	var keys []string
+	if err := sr.db.Model(&models.StoredObject{}).Where("bucket = ?", bucket).Pluck("object_key", &keys).Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return keys, nil
+}
@@ -0,0 +1,152 @@
+package repositories
+
+import (
+	"socketChat/internal/errs"
+	"socketChat/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type UploadRepository struct {
+	db *gorm.DB
+}
+
+func NewUploadRepository(db *gorm.DB) *UploadRepository {
+	return &UploadRepository{
+		db: db,
+	}
+}
+
+func (ur *UploadRepository) CreateUpload(upload *models.Upload) (*models.Upload, []error) {
+	var errors []error
+	if err := ur.db.Create(upload).Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return upload, nil
+}
+
+// GetUpload returns the upload if it belongs to the uploader
+func (ur *UploadRepository) GetUpload(uploadID, uploaderID uint) (*models.Upload, []error) {
+	var errors []error
+	var upload models.Upload
+	result := ur.db.Where("id = ? AND uploader_id = ?", uploadID, uploaderID).Limit(1).Find(&upload)
+	if err := result.Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	if result.RowsAffected == 0 {
+		errors = append(errors, errs.ErrUploadNotFound)
+		return nil, errors
+	}
+	return &upload, nil
+}
+
+// AppendChunk records a stored chunk and moves the offset past it.
+// It fails with ErrUploadOffsetMismatch if another chunk was appended at the offset in the meantime.
+func (ur *UploadRepository) AppendChunk(upload *models.Upload, chunk *models.UploadChunk, expiresAt time.Time) []error {
+	var errors []error
+	transactionErr := ur.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Upload{}).
+			Where("id = ? AND \"offset\" = ? AND completed_at IS NULL", upload.ID, chunk.Offset).
+			Updates(map[string]interface{}{
+				"offset":     gorm.Expr("\"offset\" + ?", chunk.Size),
+				"expires_at": expiresAt,
+			})
+		if err := result.Error; err != nil {
+			return err
+		}
+		if result.RowsAffected == 0 {
+			return errs.ErrUploadOffsetMismatch
+		}
+		return tx.Create(chunk).Error
+	})
+	if transactionErr != nil {
+		errors = append(errors, transactionErr)
+		return errors
+	}
+	upload.Offset = chunk.Offset + chunk.Size
+	upload.ExpiresAt = expiresAt
+	return nil
+}
+
+func (ur *UploadRepository) GetChunks(uploadID uint) ([]models.UploadChunk, []error) {
+	var errors []error
+	var chunks []models.UploadChunk
+	if err := ur.db.Where("upload_id = ?", uploadID).Order("\"offset\" ASC").Find(&chunks).Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return chunks, nil
+}
+
+// ClaimUpload marks a complete upload as being turned into an attachment, so it happens once.
+// Its expiry moves to expiresAt so the cleanup leaves its chunks alone meanwhile,
+// expired uploads can't be claimed as the cleanup may already be removing them.
+func (ur *UploadRepository) ClaimUpload(uploadID uint, expiresAt time.Time) []error {
+	var errors []error
+	now := time.Now()
+	result := ur.db.Model(&models.Upload{}).
+		Where("id = ? AND \"offset\" = size AND completed_at IS NULL AND expires_at >= ?", uploadID, now).
+		Updates(map[string]interface{}{
+			"completed_at": now,
+			"expires_at":   expiresAt,
+		})
+	if err := result.Error; err != nil {
+		errors = append(errors, err)
+		return errors
+	}
+	if result.RowsAffected == 0 {
+		errors = append(errors, errs.ErrUploadIncomplete)
+		return errors
+	}
+	return nil
+}
+
+// ReleaseUpload lets a claimed upload be completed again after a failure
+func (ur *UploadRepository) ReleaseUpload(uploadID uint) []error {
+	var errors []error
+	if err := ur.db.Model(&models.Upload{}).Where("id = ?", uploadID).Update("completed_at", nil).Error; err != nil {
+		errors = append(errors, err)
+		return errors
+	}
+	return nil
+}
+
+// DeleteUpload removes the upload and its chunk records for good, the stored chunks are left to the caller
+func (ur *UploadRepository) DeleteUpload(uploadID uint) []error {
+	var errors []error
+	transactionErr := ur.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("upload_id = ?", uploadID).Delete(&models.UploadChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id = ?", uploadID).Delete(&models.Upload{}).Error
+	})
+	if transactionErr != nil {
+		errors = append(errors, transactionErr)
+		return errors
+	}
+	return nil
+}
+
+func (ur *UploadRepository) GetExpiredUploads(now time.Time, limit int) ([]models.Upload, []error) {
+	var errors []error
+	var uploads []models.Upload
+	if err := ur.db.Where("expires_at < ?", now).Order("expires_at ASC").Limit(limit).Find(&uploads).Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return uploads, nil
+}
+
+// GetChunkObjectKeys returns the keys of the stored chunks of every upload
+func (ur *UploadRepository) GetChunkObjectKeys() ([]string, []error) {
+	var errors []error
+	var keys []string
+	if err := ur.db.Unscoped().Model(&models.UploadChunk{}).Pluck("object_key", &keys).Error; err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return keys, nil
+}
@@ -71,6 +71,16 @@ func (wr *WhiteboardRepository) FindConversationWhiteboard(conversationID uint)
 	return &whiteboard, nil
 }
 
+// CheckUserInWhiteboard tells whether the user is a member of the conversation of the whiteboard
+func (wr *WhiteboardRepository) CheckUserInWhiteboard(userID, whiteboardID uint) bool {
+	var count int64
+	wr.db.Model(&models.ConversationMember{}).
+		Joins("JOIN whiteboards ON whiteboards.conversation_id = conversation_members.conversation_id").
+		Where("conversation_members.user_id = ? AND whiteboards.id = ? AND whiteboards.deleted_at IS NULL", userID, whiteboardID).
+		Count(&count)
+	return count > 0
+}
+
 func (wr *WhiteboardRepository) CreateNewDrawn(drawn *models.Drawn) (*models.Drawn, error) {
 	result := wr.db.Create(drawn)
 	if err := result.Error; err != nil {
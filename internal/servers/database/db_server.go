@@ -51,11 +51,26 @@ func getPSQL(config *configs.Config) *models.PSQL {
 }
 
 func migrate() {
+	// Read cursors added to existing members start from the reads they already have
+	backfillReadCursors := db.Migrator().HasTable(&models.ConversationMember{}) &&
+		!db.Migrator().HasColumn(&models.ConversationMember{}, "LastReadMessageID")
+
 	err := db.AutoMigrate(
 		&models.User{},
 		&models.Conversation{},
 		&models.ConversationMember{},
 		&models.Message{},
+		&models.MessageEdit{},
+		&models.HiddenMessage{},
+		&models.MessageReaction{},
+		&models.MessageRead{},
+		&models.MessageDelivery{},
+		&models.MessageAttachment{},
+		&models.AttachmentVariant{},
+		&models.Upload{},
+		&models.UploadChunk{},
+		&models.StoredObject{},
+		&models.StorageUsage{},
 		&models.Whiteboard{},
 		&models.Drawn{},
 		&models.SubDrawn{},
@@ -63,7 +78,29 @@ func migrate() {
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 		return
-	} else {
-		log.Println("Database migrated successfully")
 	}
+	if backfillReadCursors {
+		if err := backfillLastReadMessageIds(); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+			return
+		}
+	}
+	log.Println("Database migrated successfully")
+}
+
+// backfillLastReadMessageIds moves the read cursor of every member to the latest main timeline
+// message of its conversation it read
+func backfillLastReadMessageIds() error {
+	return db.Exec(
+		`UPDATE conversation_members SET last_read_message_id = latest.message_id
+		FROM (
+			SELECT messages.conversation_id, message_reads.user_id, MAX(messages.id) AS message_id
+			FROM message_reads JOIN messages ON messages.id = message_reads.message_id
+			WHERE messages.thread_root_id IS NULL AND message_reads.deleted_at IS NULL
+			GROUP BY messages.conversation_id, message_reads.user_id
+		) AS latest
+		WHERE conversation_members.conversation_id = latest.conversation_id
+		AND conversation_members.user_id = latest.user_id
+		AND conversation_members.last_read_message_id < latest.message_id`,
+	).Error
 }
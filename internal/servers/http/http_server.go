@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"socketChat/internal/handlers"
+	"socketChat/internal/services"
 	"sync"
 
 	"github.com/gin-gonic/gin"
@@ -26,6 +27,8 @@ type HttpServer struct {
 	socketChatHandler          *handlers.SocketChatHandler
 	socketUserObservingHandler *handlers.SocketUserObservingHandler
 	socketWhiteboardHandler    *handlers.SocketWhiteboardHandler
+	socketRouterHandler        *handlers.SocketRouterHandler
+	localFileHandler           *handlers.LocalFileHandler
 	redis                      *redis.Client
 	ctx                        context.Context
 }
@@ -37,7 +40,9 @@ func NewHttpServer(
 	socketChatHandler *handlers.SocketChatHandler,
 	socketUserObservingHandler *handlers.SocketUserObservingHandler,
 	socketWhiteboardHandler *handlers.SocketWhiteboardHandler,
+	socketRouterHandler *handlers.SocketRouterHandler,
 	htmlHandler *handlers.HtmlHandler,
+	localFileHandler *handlers.LocalFileHandler,
 ) *HttpServer {
 	once.Do(func() {
 		httpServer = &HttpServer{
@@ -47,7 +52,9 @@ func NewHttpServer(
 			socketChatHandler:          socketChatHandler,
 			socketUserObservingHandler: socketUserObservingHandler,
 			socketWhiteboardHandler:    socketWhiteboardHandler,
+			socketRouterHandler:        socketRouterHandler,
 			htmlHandler:                htmlHandler,
+			localFileHandler:           localFileHandler,
 		}
 	})
 	return httpServer
@@ -57,6 +64,7 @@ func (hs *HttpServer) Run() {
 	hs.initializeGin()
 	hs.setupWebSocketRoutes()
 	hs.setupRestfulRoutes()
+	hs.setupLocalFileRoutes()
 	hs.socketChatHandler.StartSocket()
 	server := hs.startServer()
 	
@@ -116,12 +124,50 @@ func (hs *HttpServer) setupRestfulRoutes() {
 
 		authenticated.POST("/messages", hs.restHandler.SaveMessage)
 		authenticated.GET("/messages/conversation/:id", hs.restHandler.GetMessagesByConversationID)
+		authenticated.PUT("/messages/:id", hs.restHandler.EditMessage)
+		authenticated.DELETE("/messages/:id", hs.restHandler.DeleteMessage)
+		authenticated.POST("/messages/:id/reactions", hs.restHandler.AddReaction)
+		authenticated.DELETE("/messages/:id/reactions", hs.restHandler.RemoveReaction)
+		authenticated.GET("/messages/:id/thread", hs.restHandler.GetThreadMessages)
+		authenticated.GET("/messages/:id/thread/unread", hs.restHandler.GetThreadUnReadMessagesForUser)
+		authenticated.GET("/messages/:id/edits", hs.restHandler.GetMessageEdits)
+
+		authenticated.POST("/attachments", hs.restHandler.UploadAttachment)
+		authenticated.POST("/attachments/upload-url", hs.restHandler.CreateAttachmentUploadUrl)
+		authenticated.POST("/attachments/complete", hs.restHandler.CompleteAttachmentUpload)
+		authenticated.GET("/attachments/:id/url", hs.restHandler.GetAttachmentUrl)
+
+		authenticated.POST("/uploads", hs.restHandler.CreateUpload)
+		authenticated.GET("/uploads/:id", hs.restHandler.GetUpload)
+		authenticated.HEAD("/uploads/:id", hs.restHandler.GetUpload)
+		authenticated.PATCH("/uploads/:id", hs.restHandler.PatchUpload)
+		authenticated.POST("/uploads/:id/complete", hs.restHandler.CompleteUpload)
+		authenticated.DELETE("/uploads/:id", hs.restHandler.AbortUpload)
+
+		authenticated.GET("/storage/usage", hs.restHandler.GetStorageUsage)
 
 		authenticated.POST("/whiteboards", hs.restHandler.CreateWhiteboard)
 	}
 }
 
+// Signed URLs carry their own authorization, the routes are outside of the authenticated group.
+// Files of public buckets are also served at the path they were uploaded to.
+func (hs *HttpServer) setupLocalFileRoutes() {
+	if hs.localFileHandler == nil {
+		return
+	}
+	files := hs.router.Group(services.LocalFileRoutePrefix)
+	{
+		files.GET("/:bucket/*key", hs.localFileHandler.Download)
+		files.PUT("/:bucket/*key", hs.localFileHandler.Upload)
+	}
+	for _, bucketName := range services.LocalPublicFileBuckets {
+		hs.router.GET("/"+bucketName+"/*key", hs.localFileHandler.DownloadPublic(bucketName))
+	}
+}
+
 func (hs *HttpServer) setupWebSocketRoutes() {
+	hs.router.GET("/ws", hs.socketRouterHandler.HandleSocketRoute)
 	hs.router.GET("/ws/chat", hs.socketChatHandler.HandleSocketChatRoute)
 	hs.router.GET("/ws/observe", hs.socketUserObservingHandler.HandleSocketUserObservingRoute)
 	hs.router.GET("/ws/whiteboard", hs.socketWhiteboardHandler.HandleSocketWhiteboardRoute)
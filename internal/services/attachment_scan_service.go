@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"socketChat/configs"
+	"socketChat/internal/enums"
+	"socketChat/internal/errs"
+	"socketChat/internal/interfaces"
+	"socketChat/internal/models"
+	"socketChat/internal/repositories"
+	"time"
+)
+
+const (
+	defaultScannerWorkers        = 2
+	defaultScannerQueueSize      = 256
+	defaultScannerRescanInterval = 5 * time.Minute
+	defaultScannerMaxAttempts    = 5
+	// Pending attachments enqueued per rescan query
+	scannerRescanBatchSize = 100
+)
+
+// AttachmentScanService scans uploaded attachments in the background with a pool of workers.
+// Attachments stay pending, readable by their uploader only, until they are scanned clean.
+// Pending attachments the workers missed, because the queue was full, the scanner was down
+// or the instance stopped, are picked up again by a periodic rescan. Files the scanner cannot
+// take, because they are too large for it or keep being refused, are marked failed instead.
+type AttachmentScanService struct {
+	ctx                context.Context
+	attachmentRepo     *repositories.AttachmentRepository
+	chatRepo           *repositories.ChatRepository
+	fileManagerService *FileManagerService
+	scanner            interfaces.FileScanner
+	jobs               chan *models.MessageAttachment
+	maxAttempts        int
+	// Called when an attachment of a sent message is scanned
+	onScanned func(scanned *models.AttachmentScanned)
+}
+
+func NewAttachmentScanService(
+	ctx context.Context,
+	attachmentRepo *repositories.AttachmentRepository,
+	chatRepo *repositories.ChatRepository,
+	fileManagerService *FileManagerService,
+	scanner interfaces.FileScanner,
+	onScanned func(scanned *models.AttachmentScanned),
+	config *configs.Config,
+) *AttachmentScanService {
+	workers := config.Viper.GetInt("scanner.workers")
+	if workers <= 0 {
+		workers = defaultScannerWorkers
+	}
+	queueSize := config.Viper.GetInt("scanner.queue_size")
+	if queueSize <= 0 {
+		queueSize = defaultScannerQueueSize
+	}
+	rescanInterval := time.Duration(config.Viper.GetInt("scanner.rescan_interval")) * time.Second
+	if rescanInterval <= 0 {
+		rescanInterval = defaultScannerRescanInterval
+	}
+
+	maxAttempts := config.Viper.GetInt("scanner.max_attempts")
+	if maxAttempts <= 0 {
+		maxAttempts = defaultScannerMaxAttempts
+	}
+
+	ass := &AttachmentScanService{
+		ctx:                ctx,
+		attachmentRepo:     attachmentRepo,
+		chatRepo:           chatRepo,
+		fileManagerService: fileManagerService,
+		scanner:            scanner,
+		jobs:               make(chan *models.MessageAttachment, queueSize),
+		maxAttempts:        maxAttempts,
+		onScanned:          onScanned,
+	}
+	for i := 0; i < workers; i++ {
+		go ass.work()
+	}
+	go ass.rescanPending(rescanInterval)
+	return ass
+}
+
+// Enqueue schedules the scan of a saved attachment without blocking.
+// When the queue is full the attachment waits for the next rescan.
+func (ass *AttachmentScanService) Enqueue(attachment *models.MessageAttachment) bool {
+	select {
+	case ass.jobs <- attachment:
+		return true
+	default:
+		log.Printf("AttachmentScanService / Enqueue / queue is full, postponing attachment %v", attachment.ID)
+		return false
+	}
+}
+
+func (ass *AttachmentScanService) work() {
+	for {
+		select {
+		case <-ass.ctx.Done():
+			return
+		case attachment := <-ass.jobs:
+			if errors := ass.scan(attachment); len(errors) > 0 {
+				log.Printf("AttachmentScanService / work / Error scanning attachment %v: %v", attachment.ID, errors)
+			}
+		}
+	}
+}
+
+func (ass *AttachmentScanService) scan(attachment *models.MessageAttachment) []error {
+	if maxFileSize := ass.scanner.MaxFileSize(); maxFileSize > 0 && attachment.Size > maxFileSize {
+		log.Printf("AttachmentScanService / scan / attachment %v of %v bytes is too large to scan", attachment.ID, attachment.Size)
+		return ass.saveResult(attachment, enums.ATTACHMENT_SCAN_STATUS_FAILED, nil)
+	}
+	file, _, err := ass.fileManagerService.Download(attachment.Bucket, attachment.ObjectKey)
+	if err != nil {
+		return ass.recordFailure(attachment, err)
+	}
+	result, err := ass.scanner.Scan(file)
+	file.Close()
+	if err != nil {
+		return ass.recordFailure(attachment, err)
+	}
+
+	status := enums.ATTACHMENT_SCAN_STATUS_CLEAN
+	var threat *string
+	if result.Infected {
+		status = enums.ATTACHMENT_SCAN_STATUS_QUARANTINED
+		threat = &result.Threat
+		log.Printf("AttachmentScanService / scan / quarantining attachment %v of user %v: %v", attachment.ID, attachment.UploaderID, result.Threat)
+	}
+	return ass.saveResult(attachment, status, threat)
+}
+
+func (ass *AttachmentScanService) saveResult(attachment *models.MessageAttachment, status string, threat *string) []error {
+	saved, saveErrs := ass.attachmentRepo.SaveScanResult(attachment.ID, status, threat)
+	if len(saveErrs) > 0 {
+		return saveErrs
+	}
+	if !saved {
+		// Another worker got to it first
+		return nil
+	}
+	return ass.notify(attachment.ID)
+}
+
+// recordFailure counts a scan that failed because of the file: refused by the scanner or missing from the storage.
+// Such files fail the same way every time and the attachment is marked failed once they used up their attempts.
+// Failures of the scanner or of the storage themselves, like clamd being down, are not counted.
+func (ass *AttachmentScanService) recordFailure(attachment *models.MessageAttachment, scanErr error) []error {
+	if !errors.Is(scanErr, errs.ErrFileScanFailed) && scanErr != errs.ErrFileNotFound {
+		return []error{scanErr}
+	}
+	failed, recordErrs := ass.attachmentRepo.RecordScanFailure(attachment.ID, ass.maxAttempts)
+	if len(recordErrs) > 0 {
+		return append([]error{scanErr}, recordErrs...)
+	}
+	if !failed {
+		return []error{scanErr}
+	}
+	log.Printf("AttachmentScanService / recordFailure / giving up on attachment %v after %v attempts: %v", attachment.ID, ass.maxAttempts, scanErr)
+	return append([]error{scanErr}, ass.notify(attachment.ID)...)
+}
+
+// notify tells the conversation the attachment was sent to, if any, about the verdict
+func (ass *AttachmentScanService) notify(attachmentID uint) []error {
+	if ass.onScanned == nil {
+		return nil
+	}
+	attachment, getErrs := ass.attachmentRepo.GetAttachmentById(attachmentID)
+	if len(getErrs) > 0 {
+		return getErrs
+	}
+	if attachment.MessageID == nil {
+		return nil
+	}
+	message, getErrs := ass.chatRepo.GetMessageById(*attachment.MessageID)
+	if len(getErrs) > 0 {
+		return getErrs
+	}
+	attachment.Conceal()
+	ass.onScanned(&models.AttachmentScanned{
+		MessageID:      message.ID,
+		ConversationID: message.ConversationID,
+		Attachment:     attachment,
+	})
+	return nil
+}
+
+// rescanPending enqueues the attachments left pending for longer than the interval
+func (ass *AttachmentScanService) rescanPending(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ass.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var afterID uint
+		for {
+			attachments, getErrs := ass.attachmentRepo.GetPendingScans(time.Now().Add(-interval), afterID, scannerRescanBatchSize)
+			if len(getErrs) > 0 {
+				log.Printf("AttachmentScanService / rescanPending / Error getting pending attachments: %v", getErrs)
+				break
+			}
+			queued := true
+			for i := range attachments {
+				if queued = ass.Enqueue(&attachments[i]); !queued {
+					break
+				}
+				afterID = attachments[i].ID
+			}
+			if !queued || len(attachments) < scannerRescanBatchSize {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"path/filepath"
+	"slices"
+	"socketChat/configs"
+	"socketChat/internal/enums"
+	"socketChat/internal/errs"
+	"socketChat/internal/models"
+	"socketChat/internal/repositories"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultSignedUrlExpiry = 15 * time.Minute
+
+type AttachmentService struct {
+	attachmentRepo       *repositories.AttachmentRepository
+	chatRepo             *repositories.ChatRepository
+	fileManagerService   *FileManagerService
+	fileValidatorService *FileValidatorService
+	thumbnailService     *ThumbnailService
+	scanService          *AttachmentScanService
+	storageService       *StorageService
+	signedUrlExpiry      time.Duration
+}
+
+func NewAttachmentService(
+	attachmentRepo *repositories.AttachmentRepository,
+	chatRepo *repositories.ChatRepository,
+	fileManagerService *FileManagerService,
+	fileValidatorService *FileValidatorService,
+	thumbnailService *ThumbnailService,
+	scanService *AttachmentScanService,
+	storageService *StorageService,
+	config *configs.Config,
+) *AttachmentService {
+	signedUrlExpiry := time.Duration(config.Viper.GetInt("files.signed_url_expiry")) * time.Second
+	if signedUrlExpiry <= 0 {
+		signedUrlExpiry = defaultSignedUrlExpiry
+	}
+	return &AttachmentService{
+		attachmentRepo:       attachmentRepo,
+		chatRepo:             chatRepo,
+		fileManagerService:   fileManagerService,
+		fileValidatorService: fileValidatorService,
+		thumbnailService:     thumbnailService,
+		scanService:          scanService,
+		storageService:       storageService,
+		signedUrlExpiry:      signedUrlExpiry,
+	}
+}
+
+// UploadAttachment validates the file and stores it as an attachment of the uploader,
+// ready to be referenced by the next message they send. The content type is sniffed from the content.
+// Images are stripped of their metadata in memory and their thumbnails generated in the background
+// once the attachment is saved. Files are stored by content, an identical upload shares the stored file
+// but is charged to its uploader all the same.
+func (as *AttachmentService) UploadAttachment(uploaderID uint, fileName string, file io.Reader, fileSize int64) (*models.MessageAttachment, []error) {
+	bucket := enums.FILE_BUCKET_MESSAGE_ATTACHMENTS
+	validated, err := as.fileValidatorService.Validate(bucket, file, fileSize)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	object, storeErrs := as.storageService.Store(uploaderID, bucket, validated.File, validated.Size, validated.ContentType, validated.Extension)
+	if len(storeErrs) > 0 {
+		if slices.Contains(storeErrs, error(errs.ErrFileTooLarge)) || slices.Contains(storeErrs, error(errs.ErrStorageQuotaExceeded)) {
+			return nil, storeErrs
+		}
+		log.Printf("AttachmentService / UploadAttachment / Error storing file of user %v: %v", uploaderID, storeErrs)
+		return nil, []error{errs.ErrUnableToUploadFile}
+	}
+
+	attachment := &models.MessageAttachment{
+		UploaderID: uploaderID,
+		Bucket:     bucket,
+		ObjectKey:  object.ObjectKey,
+		FileName:   filepath.Base(fileName),
+		MimeType:   validated.ContentType,
+		Size:       object.Size,
+		URL:        object.URL,
+	}
+
+	thumbnails := validated.Data != nil && readImageDimensions(attachment, validated.Data)
+
+	attachment, saveErrs := as.saveAttachment(attachment, thumbnails)
+	if len(saveErrs) > 0 {
+		if releaseErrs := as.storageService.Release(uploaderID, bucket, object.ObjectKey); len(releaseErrs) > 0 {
+			log.Printf("AttachmentService / UploadAttachment / Error releasing file %v: %v", object.ObjectKey, releaseErrs)
+		}
+		return nil, saveErrs
+	}
+	return attachment, nil
+}
+
+// CreateUploadUrl issues a presigned URL the uploader can put an attachment for the conversation at.
+// Files uploaded there are staged until CompleteUpload validates them into an attachment.
+func (as *AttachmentService) CreateUploadUrl(uploaderID uint, request *models.UploadUrlRequest) (*models.UploadUrlResponse, []error) {
+	var errors []error
+	if request.FileName == "" {
+		errors = append(errors, errs.ErrInvalidRequestBody)
+		return nil, errors
+	}
+	if !as.chatRepo.CheckUserInConversation(uploaderID, request.ConversationID) {
+		errors = append(errors, errs.ErrInvalidConversationId)
+		return nil, errors
+	}
+
+	objectKey := newAttachmentObjectKey(uploaderID, filepath.Ext(request.FileName))
+	uploadUrl, err := as.fileManagerService.PresignPut(enums.FILE_BUCKET_UPLOAD_CHUNKS, objectKey, as.signedUrlExpiry)
+	if err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return &models.UploadUrlResponse{
+		ObjectKey: objectKey,
+		UploadURL: uploadUrl,
+		ExpiresAt: time.Now().Add(as.signedUrlExpiry),
+	}, nil
+}
+
+// CompleteUpload validates a file uploaded through an upload URL and records it as an attachment of the uploader
+func (as *AttachmentService) CompleteUpload(uploaderID uint, request *models.CompleteUploadRequest) (*models.MessageAttachment, []error) {
+	var errors []error
+	if request.FileName == "" {
+		errors = append(errors, errs.ErrInvalidRequestBody)
+		return nil, errors
+	}
+	// Upload URLs are only issued for keys under the uploader's own prefix
+	if !strings.HasPrefix(request.ObjectKey, fmt.Sprintf("%d/", uploaderID)) || strings.Contains(request.ObjectKey, "..") {
+		errors = append(errors, errs.ErrInvalidObjectKey)
+		return nil, errors
+	}
+
+	file, info, err := as.fileManagerService.Download(enums.FILE_BUCKET_UPLOAD_CHUNKS, request.ObjectKey)
+	if err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	attachment, uploadErrs := as.UploadAttachment(uploaderID, request.FileName, file, info.Size)
+	file.Close()
+
+	// Staged files are dropped whether they were accepted or not
+	if err := as.fileManagerService.Delete(enums.FILE_BUCKET_UPLOAD_CHUNKS, request.ObjectKey); err != nil {
+		log.Printf("AttachmentService / CompleteUpload / Error deleting staged file %v: %v", request.ObjectKey, err)
+	}
+	return attachment, uploadErrs
+}
+
+// GetAttachmentUrl issues a presigned download URL of the attachment, or of its variant of the given size.
+// Only the uploader and, once the attachment is sent, the members of the conversation can get one.
+func (as *AttachmentService) GetAttachmentUrl(attachmentID, userID uint, variantSize int) (*models.SignedUrlResponse, []error) {
+	var errors []error
+	attachment, getErrs := as.attachmentRepo.GetAttachmentById(attachmentID)
+	if len(getErrs) > 0 {
+		return nil, getErrs
+	}
+	if !as.canAccess(attachment, userID) {
+		// Attachments of other conversations are reported as missing
+		errors = append(errors, errs.ErrAttachmentNotFound)
+		return nil, errors
+	}
+	// Until the file is scanned clean only its uploader can read it, and nobody once it is quarantined
+	switch {
+	case attachment.ScanStatus == enums.ATTACHMENT_SCAN_STATUS_QUARANTINED:
+		errors = append(errors, errs.ErrAttachmentQuarantined)
+		return nil, errors
+	case attachment.ScanStatus != enums.ATTACHMENT_SCAN_STATUS_CLEAN && attachment.UploaderID != userID:
+		errors = append(errors, errs.ErrAttachmentNotScanned)
+		return nil, errors
+	}
+
+	objectKey := attachment.ObjectKey
+	if variantSize > 0 {
+		index := slices.IndexFunc(attachment.Variants, func(variant models.AttachmentVariant) bool {
+			return variant.Size == variantSize
+		})
+		if index < 0 {
+			errors = append(errors, errs.ErrFileNotFound)
+			return nil, errors
+		}
+		objectKey = attachment.Variants[index].ObjectKey
+	}
+
+	url, err := as.fileManagerService.PresignGet(attachment.Bucket, objectKey, as.signedUrlExpiry)
+	if err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	return &models.SignedUrlResponse{
+		URL:       url,
+		ExpiresAt: time.Now().Add(as.signedUrlExpiry),
+	}, nil
+}
+
+func (as *AttachmentService) canAccess(attachment *models.MessageAttachment, userID uint) bool {
+	if attachment.UploaderID == userID {
+		return true
+	}
+	if attachment.MessageID == nil {
+		return false
+	}
+	message, getErrs := as.chatRepo.GetMessageById(*attachment.MessageID)
+	if len(getErrs) > 0 {
+		return false
+	}
+	return as.chatRepo.CheckUserInConversation(userID, message.ConversationID)
+}
+
+func (as *AttachmentService) saveAttachment(attachment *models.MessageAttachment, thumbnails bool) (*models.MessageAttachment, []error) {
+	attachment, saveErrs := as.attachmentRepo.SaveAttachment(attachment)
+	if len(saveErrs) > 0 {
+		return nil, saveErrs
+	}
+	as.scanService.Enqueue(attachment)
+	if thumbnails {
+		as.thumbnailService.Enqueue(attachment)
+	}
+	return attachment, nil
+}
+
+// newAttachmentObjectKey never reuses the client file name
+func newAttachmentObjectKey(uploaderID uint, extension string) string {
+	return fmt.Sprintf("%d/%s%s", uploaderID, uuid.NewString(), strings.ToLower(extension))
+}
+
+// readImageDimensions sets the dimensions of an image attachment and tells
+// whether it is an image thumbnails can be generated for
+func readImageDimensions(attachment *models.MessageAttachment, data []byte) bool {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		log.Printf("AttachmentService / readImageDimensions / Could not read dimensions of %v: %v", attachment.FileName, err)
+		return false
+	}
+	attachment.Width = &config.Width
+	attachment.Height = &config.Height
+	return true
+}
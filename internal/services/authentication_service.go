@@ -108,11 +108,11 @@ func (as *AuthenticationService) GetSingleUser(id int) (*models.UserResponse, []
 	return userResponse, nil
 }
 
-func (as *AuthenticationService) UpdateUserProfilePhoto(id uint, photo string) []error {
+func (as *AuthenticationService) UpdateUserProfilePhoto(id uint, photo *models.ProfilePhotoResponse) (*models.ProfilePhotoResponse, []error) {
 	var errors []error
 	if id <= 0 {
 		errors = append(errors, errs.ErrInvalidParams)
-		return errors
+		return nil, errors
 	}
 	return as.authRepo.UpdateUserProfilePhoto(id, photo)
 }
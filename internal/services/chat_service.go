@@ -1,18 +1,38 @@
 package services
 
 import (
+	"log"
+	"slices"
+	"socketChat/configs"
+	"socketChat/internal/enums"
 	"socketChat/internal/errs"
 	"socketChat/internal/models"
 	"socketChat/internal/repositories"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
 )
 
+// Longest accepted reaction, in runes, enough for emojis joined with modifiers
+const maxReactionEmojiLength = 16
+
 type ChatService struct {
-	chatRepo *repositories.ChatRepository
+	chatRepo       *repositories.ChatRepository
+	storageService *StorageService
+	config         *configs.Config
 }
 
-func NewChatService(chatRepo *repositories.ChatRepository) *ChatService {
+func NewChatService(
+	chatRepo *repositories.ChatRepository,
+	storageService *StorageService,
+	config *configs.Config,
+) *ChatService {
 	return &ChatService{
-		chatRepo: chatRepo,
+		chatRepo:       chatRepo,
+		storageService: storageService,
+		config:         config,
 	}
 }
 
@@ -31,12 +51,171 @@ func (cs *ChatService) GetUserConversations(userID uint, page, size int) (*model
 	return cs.chatRepo.GetUserConversations(userID, page, size)
 }
 
-func (cs *ChatService) SaveMessage(message *models.Message) (*models.Message, []error) {
-	return cs.chatRepo.SaveMessage(message)
+// SaveMessage stores the message, the bool tells whether it was already sent with the same client ID
+func (cs *ChatService) SaveMessage(message *models.Message, attachmentIds []uint) (*models.Message, bool, []error) {
+	if message.ClientID != nil {
+		if _, err := uuid.Parse(*message.ClientID); err != nil {
+			return nil, false, []error{errs.ErrInvalidClientId}
+		}
+	}
+	var replyTo *models.MessagePreview
+	if message.ReplyToID != nil {
+		// Replies must quote a message of the same conversation
+		quoted, getMessageErrs := cs.chatRepo.GetMessageById(*message.ReplyToID)
+		if len(getMessageErrs) > 0 || quoted.ConversationID != message.ConversationID {
+			return nil, false, []error{errs.ErrInvalidReplyTo}
+		}
+		replyTo = quoted.ToMessagePreview()
+	}
+	if message.ThreadRootID != nil {
+		// Threads hang off top level messages of the same conversation, they don't nest
+		root, getMessageErrs := cs.chatRepo.GetMessageById(*message.ThreadRootID)
+		if len(getMessageErrs) > 0 || root.ConversationID != message.ConversationID || root.ThreadRootID != nil {
+			return nil, false, []error{errs.ErrInvalidThreadRoot}
+		}
+	}
+	conversationID := message.ConversationID
+	slices.Sort(attachmentIds)
+	conversationQuota := max(cs.config.Viper.GetInt64("storage.conversation_quota"), 0)
+	savedMessage, duplicate, saveErrs := cs.chatRepo.SaveMessage(message, slices.Compact(attachmentIds), conversationQuota)
+	if len(saveErrs) > 0 {
+		return nil, false, saveErrs
+	}
+	// A client ID reused in another conversation must not leak the original message
+	if savedMessage.ConversationID != conversationID {
+		return nil, false, []error{errs.ErrInvalidClientId}
+	}
+	savedMessage.ReplyTo = replyTo
+	return savedMessage, duplicate, nil
+}
+
+func (cs *ChatService) GetMessagesByConversationId(conversationID, userID uint, page, size int) (*models.MessageListResponse, []error) {
+	return cs.chatRepo.GetMessagesByConversationId(conversationID, userID, page, size)
+}
+
+func (cs *ChatService) GetMessageById(messageID uint) (*models.Message, []error) {
+	return cs.chatRepo.GetMessageById(messageID)
+}
+
+func (cs *ChatService) EditMessage(messageID, editorID uint, content string) (*models.Message, []error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, []error{errs.ErrEmptyMessageContent}
+	}
+	return cs.chatRepo.EditMessage(messageID, editorID, content)
+}
+
+// GetMessageEdits returns the prior revisions of a message, oldest first, to members of its conversation
+func (cs *ChatService) GetMessageEdits(messageID, userID uint) ([]models.MessageEdit, []error) {
+	message, getMessageErrs := cs.chatRepo.GetMessageById(messageID)
+	if len(getMessageErrs) > 0 {
+		return nil, getMessageErrs
+	}
+	if !cs.chatRepo.CheckUserInConversation(userID, message.ConversationID) {
+		return nil, []error{errs.ErrMessageNotFound}
+	}
+	return cs.chatRepo.GetMessageEdits(messageID)
+}
+
+// DeleteMessage deletes the message for the user only or, for its sender, for everyone.
+// The returned message is only set for everyone-deletes, which have to be broadcast.
+func (cs *ChatService) DeleteMessage(messageID, userID uint, scope string) (*models.Message, []error) {
+	switch scope {
+	case enums.MESSAGE_DELETE_SCOPE_ME:
+		return nil, cs.chatRepo.HideMessage(messageID, userID)
+	case enums.MESSAGE_DELETE_SCOPE_EVERYONE:
+		window := time.Duration(cs.config.Viper.GetInt("message.delete_for_everyone_window")) * time.Second
+		message, attachments, deleteErrs := cs.chatRepo.DeleteMessageForEveryone(messageID, userID, window)
+		if len(deleteErrs) > 0 {
+			return nil, deleteErrs
+		}
+		for _, attachment := range attachments {
+			// Attachments uploaded before deduplication have no stored object, their files are orphaned as is
+			releaseErrs := cs.storageService.Release(attachment.UploaderID, attachment.Bucket, attachment.ObjectKey)
+			if len(releaseErrs) > 0 && releaseErrs[0] != errs.ErrFileNotFound {
+				log.Printf("ChatService / DeleteMessage / Error releasing file of attachment %v: %v", attachment.ID, releaseErrs)
+			}
+		}
+		return message, nil
+	default:
+		return nil, []error{errs.ErrInvalidDeleteScope}
+	}
+}
+
+// AddReaction reacts to a message of one of the user's conversations and returns the message
+func (cs *ChatService) AddReaction(messageID, userID uint, emoji string) (*models.Message, []error) {
+	message, errs := cs.getReactableMessage(messageID, userID, emoji)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	addErrs := cs.chatRepo.AddReaction(&models.MessageReaction{
+		MessageID: messageID,
+		UserID:    userID,
+		Emoji:     emoji,
+	})
+	if len(addErrs) > 0 {
+		return nil, addErrs
+	}
+	return message, nil
+}
+
+// RemoveReaction takes the user's reaction back and returns the message
+func (cs *ChatService) RemoveReaction(messageID, userID uint, emoji string) (*models.Message, []error) {
+	message, errs := cs.getReactableMessage(messageID, userID, emoji)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	removeErrs := cs.chatRepo.RemoveReaction(messageID, userID, emoji)
+	if len(removeErrs) > 0 {
+		return nil, removeErrs
+	}
+	return message, nil
+}
+
+func (cs *ChatService) getReactableMessage(messageID, userID uint, emoji string) (*models.Message, []error) {
+	if emoji == "" || utf8.RuneCountInString(emoji) > maxReactionEmojiLength {
+		return nil, []error{errs.ErrInvalidEmoji}
+	}
+	message, getMessageErrs := cs.chatRepo.GetMessageById(messageID)
+	if len(getMessageErrs) > 0 {
+		return nil, getMessageErrs
+	}
+	if !cs.chatRepo.CheckUserInConversation(userID, message.ConversationID) {
+		return nil, []error{errs.ErrMessageNotFound}
+	}
+	return message, nil
+}
+
+// GetThreadMessages lists the replies of a thread root to members of its conversation
+func (cs *ChatService) GetThreadMessages(threadRootID, userID uint, page, size int) (*models.MessageListResponse, []error) {
+	if _, errs := cs.getThreadRoot(threadRootID, userID); len(errs) > 0 {
+		return nil, errs
+	}
+	return cs.chatRepo.GetThreadMessages(threadRootID, userID, page, size)
 }
 
-func (cs *ChatService) GetMessagesByConversationId(conversationID uint, page, size int) (*models.MessageListResponse, []error) {
-	return cs.chatRepo.GetMessagesByConversationId(conversationID, page, size)
+func (cs *ChatService) GetThreadUnReadMessagesForUser(threadRootID, userID uint) (int, []error) {
+	if _, errs := cs.getThreadRoot(threadRootID, userID); len(errs) > 0 {
+		return 0, errs
+	}
+	count, err := cs.chatRepo.GetThreadUnReadMessagesForUser(threadRootID, userID)
+	if err != nil {
+		return 0, []error{err}
+	}
+	return count, nil
+}
+
+func (cs *ChatService) getThreadRoot(threadRootID, userID uint) (*models.Message, []error) {
+	root, getMessageErrs := cs.chatRepo.GetMessageById(threadRootID)
+	if len(getMessageErrs) > 0 {
+		return nil, getMessageErrs
+	}
+	if root.ThreadRootID != nil {
+		return nil, []error{errs.ErrInvalidThreadRoot}
+	}
+	if !cs.chatRepo.CheckUserInConversation(userID, root.ConversationID) {
+		return nil, []error{errs.ErrMessageNotFound}
+	}
+	return root, nil
 }
 
 func (cs *ChatService) CheckConversationExists(conversationID uint) bool {
@@ -47,12 +226,26 @@ func (cs *ChatService) CheckUserInConversation(userID, conversationID uint) bool
 	return cs.chatRepo.CheckUserInConversation(userID, conversationID)
 }
 
-func (cs *ChatService) SeenMessage(messageIds []uint, seenerId uint) []error {
+func (cs *ChatService) SeenMessage(conversationId uint, messageIds []uint, seenerId uint) []error {
 	// Validate message id
 	if len(messageIds) <= 0 {
 		return []error{errs.ErrMessageNotFound}
 	}
-	return cs.chatRepo.SeenMessage(messageIds, seenerId)
+	return cs.chatRepo.SeenMessage(conversationId, messageIds, seenerId)
+}
+
+func (cs *ChatService) RecordDeliveries(messageIds []uint, recipientId uint) ([]models.MessageDelivery, []error) {
+	if len(messageIds) == 0 {
+		return nil, nil
+	}
+	return cs.chatRepo.RecordDeliveries(messageIds, recipientId)
+}
+
+func (cs *ChatService) MarkReadUpTo(conversationID, userID, messageID uint) (bool, []error) {
+	if messageID == 0 {
+		return false, []error{errs.ErrInvalidReadPosition}
+	}
+	return cs.chatRepo.MarkReadUpTo(conversationID, userID, messageID)
 }
 
 func (cs *ChatService) GetConversationUnReadMessagesForUser(conversationID, userID uint) (int, error) {
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"socketChat/configs"
+	"socketChat/internal/errs"
+	"socketChat/internal/models"
+	"strings"
+	"time"
+)
+
+const (
+	defaultClamAVAddress = "localhost:3310"
+	defaultClamAVTimeout = 2 * time.Minute
+	// Size of the chunks the file is streamed to clamd in
+	clamAVChunkSize = 64 << 10
+)
+
+// ClamAVScannerService scans files with a clamd daemon over TCP, streaming them with the INSTREAM command.
+// Files larger than the StreamMaxLength of clamd fail to scan, scanner.max_file_size should match it.
+type ClamAVScannerService struct {
+	address     string
+	timeout     time.Duration
+	maxFileSize int64
+}
+
+func NewClamAVScannerService(config *configs.Config) *ClamAVScannerService {
+	address := config.Viper.GetString("scanner.clamd_address")
+	if address == "" {
+		address = defaultClamAVAddress
+	}
+	timeout := time.Duration(config.Viper.GetInt("scanner.timeout")) * time.Second
+	if timeout <= 0 {
+		timeout = defaultClamAVTimeout
+	}
+	return &ClamAVScannerService{
+		address:     address,
+		timeout:     timeout,
+		maxFileSize: config.Viper.GetInt64("scanner.max_file_size"),
+	}
+}
+
+func (cs *ClamAVScannerService) Scan(file io.Reader) (*models.ScanResult, error) {
+	conn, err := net.DialTimeout("tcp", cs.address, cs.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(cs.timeout)); err != nil {
+		return nil, err
+	}
+
+	if streamErr := cs.stream(conn, file); streamErr != nil {
+		// clamd replies before closing the connection when it refuses the stream, its reply tells why
+		if reply, err := cs.readReply(conn); err == nil {
+			return parseClamAVReply(reply)
+		}
+		return nil, streamErr
+	}
+	reply, err := cs.readReply(conn)
+	if err != nil {
+		return nil, err
+	}
+	return parseClamAVReply(reply)
+}
+
+func (cs *ClamAVScannerService) MaxFileSize() int64 {
+	return cs.maxFileSize
+}
+
+// stream sends the file as length prefixed chunks ended by an empty chunk
+func (cs *ClamAVScannerService) stream(conn net.Conn, file io.Reader) error {
+	writer := bufio.NewWriterSize(conn, clamAVChunkSize+4)
+	if _, err := writer.WriteString("zINSTREAM\x00"); err != nil {
+		return err
+	}
+	buffer := make([]byte, clamAVChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, readErr := io.ReadFull(file, buffer)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := writer.Write(size); err != nil {
+				return err
+			}
+			if _, err := writer.Write(buffer[:n]); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := writer.Write(size); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// readReply reads the null terminated reply of a z-prefixed command
+func (cs *ClamAVScannerService) readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && !(err == io.EOF && len(reply) > 0) {
+		return "", err
+	}
+	return string(bytes.TrimRight(reply, "\x00\n")), nil
+}
+
+// parseClamAVReply reads replies like "stream: OK", "stream: Eicar-Signature FOUND"
+// and "INSTREAM size limit exceeded. ERROR"
+func parseClamAVReply(reply string) (*models.ScanResult, error) {
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return &models.ScanResult{}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return &models.ScanResult{
+			Infected: true,
+			Threat:   strings.TrimSuffix(result, " FOUND"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: %v", errs.ErrFileScanFailed, reply)
+	}
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"socketChat/internal/errs"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+	// StreamMaxLength of the fake clamd
+	fakeClamdMaxLength = 256 << 10
+)
+
+// startFakeClamd answers INSTREAM commands the way clamd does: EICAR is found, streams over
+// fakeClamdMaxLength are refused. It returns the address it listens at.
+func startFakeClamd(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeClamd(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveFakeClamd(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	command, err := reader.ReadString(0)
+	if err != nil || command != "zINSTREAM\x00" {
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+
+	var content bytes.Buffer
+	size := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(reader, size); err != nil {
+			return
+		}
+		length := binary.BigEndian.Uint32(size)
+		if length == 0 {
+			break
+		}
+		if _, err := io.CopyN(&content, reader, int64(length)); err != nil {
+			return
+		}
+		if content.Len() > fakeClamdMaxLength {
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			// Let the client finish writing so that it reads the reply rather than a reset connection
+			io.Copy(io.Discard, reader)
+			return
+		}
+	}
+
+	if bytes.Contains(content.Bytes(), []byte(eicar)) {
+		conn.Write([]byte("stream: Eicar-Signature FOUND\x00"))
+		return
+	}
+	conn.Write([]byte("stream: OK\x00"))
+}
+
+func TestClamAVScannerServiceScan(t *testing.T) {
+	scanner := &ClamAVScannerService{address: startFakeClamd(t), timeout: 10 * time.Second}
+
+	tests := []struct {
+		name         string
+		file         io.Reader
+		wantInfected bool
+		wantThreat   string
+		wantErr      error
+	}{
+		{name: "clean", file: strings.NewReader("nothing to see here")},
+		{name: "empty", file: strings.NewReader("")},
+		{name: "clean over several chunks", file: bytes.NewReader(bytes.Repeat([]byte("a"), 3*clamAVChunkSize+1))},
+		{name: "infected", file: strings.NewReader(eicar), wantInfected: true, wantThreat: "Eicar-Signature"},
+		{
+			name:         "infected past the first chunk",
+			file:         io.MultiReader(bytes.NewReader(make([]byte, clamAVChunkSize+10)), strings.NewReader(eicar)),
+			wantInfected: true,
+			wantThreat:   "Eicar-Signature",
+		},
+		{name: "over the size limit", file: bytes.NewReader(make([]byte, 4*fakeClamdMaxLength)), wantErr: errs.ErrFileScanFailed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := scanner.Scan(test.file)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("Scan() error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			if result.Infected != test.wantInfected || result.Threat != test.wantThreat {
+				t.Errorf("Scan() = %+v, want infected %v with %q", result, test.wantInfected, test.wantThreat)
+			}
+		})
+	}
+}
+
+// A scanner that cannot be reached is not the fault of the file, the scan must not look refused
+func TestClamAVScannerServiceScanUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	scanner := &ClamAVScannerService{address: address, timeout: time.Second}
+	_, err = scanner.Scan(strings.NewReader("file"))
+	if err == nil || errors.Is(err, errs.ErrFileScanFailed) {
+		t.Fatalf("Scan() error = %v, want a connection error", err)
+	}
+}
+
+func TestParseClamAVReply(t *testing.T) {
+	tests := []struct {
+		reply        string
+		wantInfected bool
+		wantThreat   string
+		wantErr      bool
+	}{
+		{reply: "stream: OK"},
+		{reply: "stream: Eicar-Signature FOUND", wantInfected: true, wantThreat: "Eicar-Signature"},
+		{reply: "stream: Win.Test.EICAR_HDB-1 FOUND", wantInfected: true, wantThreat: "Win.Test.EICAR_HDB-1"},
+		{reply: "INSTREAM size limit exceeded. ERROR", wantErr: true},
+		{reply: "stream: Can't allocate memory ERROR", wantErr: true},
+		{reply: "", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.reply, func(t *testing.T) {
+			result, err := parseClamAVReply(test.reply)
+			if test.wantErr {
+				if !errors.Is(err, errs.ErrFileScanFailed) {
+					t.Fatalf("parseClamAVReply() error = %v, want %v", err, errs.ErrFileScanFailed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseClamAVReply() error = %v", err)
+			}
+			if result.Infected != test.wantInfected || result.Threat != test.wantThreat {
+				t.Errorf("parseClamAVReply() = %+v, want infected %v with %q", result, test.wantInfected, test.wantThreat)
+			}
+		})
+	}
+}
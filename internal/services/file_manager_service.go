@@ -3,6 +3,8 @@ package services
 import (
 	"io"
 	"socketChat/internal/interfaces"
+	"socketChat/internal/models"
+	"time"
 )
 
 type FileManagerService struct {
@@ -15,6 +17,38 @@ func NewFileManagerService(fileManager interfaces.FileManager) *FileManagerServi
 	}
 }
 
-func (fs *FileManagerService) UploadUserProfilePhoto(fileName string, file io.Reader, fileSize int64, contentType string, bucketName string) (string, error) {
+func (fs *FileManagerService) UploadFile(fileName string, file io.Reader, fileSize int64, contentType string, bucketName string) (string, error) {
 	return fs.fileManager.UploadFile(fileName, file, fileSize, contentType, bucketName)
 }
+
+func (fs *FileManagerService) UploadAttachment(fileName string, file io.Reader, fileSize int64, contentType string, bucketName string) (string, error) {
+	return fs.fileManager.UploadFile(fileName, file, fileSize, contentType, bucketName)
+}
+
+func (fs *FileManagerService) UploadChunk(fileName string, file io.Reader, fileSize int64, bucketName string) (string, error) {
+	return fs.fileManager.UploadFile(fileName, file, fileSize, "application/octet-stream", bucketName)
+}
+
+func (fs *FileManagerService) Download(bucketName string, fileName string) (io.ReadCloser, *models.FileInfo, error) {
+	return fs.fileManager.Download(bucketName, fileName)
+}
+
+func (fs *FileManagerService) Delete(bucketName string, fileName string) error {
+	return fs.fileManager.Delete(bucketName, fileName)
+}
+
+func (fs *FileManagerService) Stat(bucketName string, fileName string) (*models.FileInfo, error) {
+	return fs.fileManager.Stat(bucketName, fileName)
+}
+
+func (fs *FileManagerService) PresignGet(bucketName string, fileName string, expiry time.Duration) (string, error) {
+	return fs.fileManager.PresignGet(bucketName, fileName, expiry)
+}
+
+func (fs *FileManagerService) PresignPut(bucketName string, fileName string, expiry time.Duration) (string, error) {
+	return fs.fileManager.PresignPut(bucketName, fileName, expiry)
+}
+
+func (fs *FileManagerService) List(bucketName string, fn func(info *models.FileInfo) error) error {
+	return fs.fileManager.List(bucketName, fn)
+}
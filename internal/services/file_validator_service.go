@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"mime"
+	"socketChat/configs"
+	"socketChat/internal/enums"
+	"socketChat/internal/errs"
+	"socketChat/internal/models"
+	"socketChat/internal/utils"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+const (
+	// Bytes sniffed to detect the content type, the detector's default read limit
+	fileSniffLength = 3072
+	// Largest image read into memory when the bucket sets no image limit
+	defaultMaxImageSize = 20 << 20
+)
+
+// Markup that makes a file a browser could render as a page, never expected in binary formats
+var polyglotMarkers = [][]byte{
+	[]byte("<script"),
+	[]byte("<html"),
+	[]byte("<!doctype html"),
+	[]byte("<iframe"),
+	[]byte("<svg"),
+	[]byte("<?php"),
+}
+
+// FileValidatorService checks uploads before they reach the file manager. The content type is
+// sniffed from the content, the client's header and file extension are never trusted.
+type FileValidatorService struct {
+	// [bucket] => rules
+	rules     map[string]*fileValidationRules
+	maxPixels int
+}
+
+type fileValidationRules struct {
+	// Content types, "image/*" allows every subtype
+	allowedTypes []string
+	maxSize      int64
+	// Images are read into memory, they have a limit of their own
+	maxImageSize int64
+}
+
+func NewFileValidatorService(config *configs.Config) *FileValidatorService {
+	rules := make(map[string]*fileValidationRules)
+	for _, bucketName := range enums.FILE_BUCKETS {
+		maxImageSize := config.Viper.GetInt64("validation." + bucketName + ".max_image_size")
+		if maxImageSize <= 0 {
+			maxImageSize = defaultMaxImageSize
+		}
+		rules[bucketName] = &fileValidationRules{
+			allowedTypes: config.Viper.GetStringSlice("validation." + bucketName + ".allowed_types"),
+			maxSize:      config.Viper.GetInt64("validation." + bucketName + ".max_size"),
+			maxImageSize: maxImageSize,
+		}
+	}
+	return &FileValidatorService{
+		rules:     rules,
+		maxPixels: config.Viper.GetInt("thumbnail.max_pixels"),
+	}
+}
+
+// Validate sniffs the content type of the file and checks it against the allowlist and size limit
+// of the bucket. Images are held to the image size limit of the bucket, decoded to reject malformed ones
+// and stripped of their metadata.
+// fileSize is -1 if unknown, the returned file then fails with ErrFileTooLarge past the limit.
+func (fvs *FileValidatorService) Validate(bucketName string, file io.Reader, fileSize int64) (*models.ValidatedFile, error) {
+	rules, ok := fvs.rules[bucketName]
+	if !ok {
+		return nil, errs.ErrFileTypeNotAllowed
+	}
+	if rules.maxSize > 0 && fileSize > rules.maxSize {
+		return nil, errs.ErrFileTooLarge
+	}
+
+	header := make([]byte, fileSniffLength)
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	header = header[:n]
+	if n == 0 {
+		return nil, errs.ErrMalformedFile
+	}
+
+	detected := mimetype.Detect(header)
+	contentType, _, err := mime.ParseMediaType(detected.String())
+	if err != nil {
+		return nil, errs.ErrMalformedFile
+	}
+	if !isContentTypeAllowed(contentType, rules.allowedTypes) {
+		return nil, errs.ErrFileTypeNotAllowed
+	}
+	// Text may legitimately contain markup, it is served as plain text.
+	// Images are checked once stripped of their metadata and trailing data.
+	isImage := strings.HasPrefix(contentType, "image/")
+	if !isImage && !strings.HasPrefix(contentType, "text/") && containsPolyglotMarker(header) {
+		return nil, errs.ErrPolyglotFile
+	}
+
+	validated := &models.ValidatedFile{
+		File:        io.MultiReader(bytes.NewReader(header), file),
+		Size:        fileSize,
+		ContentType: contentType,
+		Extension:   detected.Extension(),
+	}
+	if rules.maxSize > 0 {
+		validated.File = &maxSizeReader{reader: validated.File, remaining: rules.maxSize}
+	}
+
+	if isImage {
+		if err := fvs.validateImage(validated, rules.maxImageSize); err != nil {
+			return nil, err
+		}
+	}
+	return validated, nil
+}
+
+// validateImage reads the image, decodes it and replaces it with its stripped version.
+// The dimensions are read from the header first, so images with too many pixels are never buffered.
+func (fvs *FileValidatorService) validateImage(validated *models.ValidatedFile, maxImageSize int64) error {
+	if validated.Size > maxImageSize {
+		return errs.ErrFileTooLarge
+	}
+	file := &maxSizeReader{reader: validated.File, remaining: maxImageSize}
+
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(file, &header))
+	if err != nil {
+		if errors.Is(err, errs.ErrFileTooLarge) {
+			return errs.ErrFileTooLarge
+		}
+		return errs.ErrMalformedFile
+	}
+	if fvs.maxPixels > 0 && config.Width*config.Height > fvs.maxPixels {
+		return errs.ErrImageTooLarge
+	}
+
+	data, err := io.ReadAll(io.MultiReader(&header, file))
+	if err != nil {
+		return err
+	}
+	stripped, err := utils.StripImageMetadata(data, validated.ContentType)
+	if err != nil {
+		return err
+	}
+	if _, err := utils.DecodeImage(stripped, fvs.maxPixels); err != nil {
+		if err == errs.ErrImageTooLarge {
+			return err
+		}
+		return errs.ErrMalformedFile
+	}
+	if containsPolyglotMarker(stripped) {
+		return errs.ErrPolyglotFile
+	}
+
+	validated.Data = stripped
+	validated.File = bytes.NewReader(stripped)
+	validated.Size = int64(len(stripped))
+	return nil
+}
+
+func isContentTypeAllowed(contentType string, allowedTypes []string) bool {
+	for _, allowedType := range allowedTypes {
+		if allowedType == contentType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowedType, "/*"); ok && strings.HasPrefix(contentType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPolyglotMarker(data []byte) bool {
+	lower := bytes.ToLower(data)
+	for _, marker := range polyglotMarkers {
+		if bytes.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxSizeReader fails with ErrFileTooLarge once more than remaining bytes are read
+type maxSizeReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (msr *maxSizeReader) Read(p []byte) (int, error) {
+	if msr.remaining < 0 {
+		return 0, errs.ErrFileTooLarge
+	}
+	// Read one byte past the limit to tell a file of exactly the limit from a larger one
+	if int64(len(p)) > msr.remaining+1 {
+		p = p[:msr.remaining+1]
+	}
+	n, err := msr.reader.Read(p)
+	msr.remaining -= int64(n)
+	if msr.remaining < 0 {
+		return n + int(msr.remaining), errs.ErrFileTooLarge
+	}
+	return n, err
+}
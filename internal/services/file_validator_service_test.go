@@ -0,0 +1,240 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"math/rand"
+	"socketChat/configs"
+	"socketChat/internal/enums"
+	"socketChat/internal/errs"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	testMaxSize      = 1 << 20
+	testMaxImageSize = 64 << 10
+	testMaxPixels    = 1 << 16
+)
+
+func newTestFileValidatorService() *FileValidatorService {
+	v := viper.New()
+	bucket := "validation." + enums.FILE_BUCKET_MESSAGE_ATTACHMENTS
+	v.Set(bucket+".allowed_types", []string{"image/png", "image/jpeg", "application/pdf", "text/*"})
+	v.Set(bucket+".max_size", testMaxSize)
+	v.Set(bucket+".max_image_size", testMaxImageSize)
+	v.Set("thumbnail.max_pixels", testMaxPixels)
+	return NewFileValidatorService(&configs.Config{Viper: v})
+}
+
+func encodeTestPng(t *testing.T, width, height int, noise bool) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	random := rand.New(rand.NewSource(1))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255}
+			if noise {
+				c = color.RGBA{R: uint8(random.Intn(256)), G: uint8(random.Intn(256)), B: uint8(random.Intn(256)), A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// failingReader fails every read, standing for the part of a file that must not be read
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read past the image header")
+}
+
+func TestFileValidatorServiceValidate(t *testing.T) {
+	smallPng := encodeTestPng(t, 16, 16, false)
+	var smallGif bytes.Buffer
+	if err := gif.Encode(&smallGif, image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+	pdf := []byte("%PDF-1.4\n1 0 obj << /Type /Catalog >> endobj\n%%EOF\n")
+
+	tests := []struct {
+		name            string
+		bucket          string
+		data            []byte
+		unknownSize     bool
+		wantErr         error
+		wantContentType string
+		wantImage       bool
+	}{
+		{name: "png", data: smallPng, wantContentType: "image/png", wantImage: true},
+		{name: "png of unknown size", data: smallPng, unknownSize: true, wantContentType: "image/png", wantImage: true},
+		{name: "pdf", data: pdf, wantContentType: "application/pdf"},
+		{name: "text with markup", data: []byte("see <script>alert(1)</script>"), wantContentType: "text/plain"},
+		{name: "pdf with markup", data: append(bytes.Clone(pdf), "<script>alert(1)</script>"...), wantErr: errs.ErrPolyglotFile},
+		{name: "type not allowed", data: smallGif.Bytes(), wantErr: errs.ErrFileTypeNotAllowed},
+		{name: "unknown bucket", bucket: "unknown", data: smallPng, wantErr: errs.ErrFileTypeNotAllowed},
+		{name: "empty", data: nil, wantErr: errs.ErrMalformedFile},
+		{name: "over the size limit", data: bytes.Repeat([]byte("a"), testMaxSize+1), wantErr: errs.ErrFileTooLarge},
+		{name: "too many pixels", data: encodeTestPng(t, 512, 512, false), wantErr: errs.ErrImageTooLarge},
+		{name: "over the image size limit", data: encodeTestPng(t, 250, 250, true), wantErr: errs.ErrFileTooLarge},
+		{name: "over the image size limit of unknown size", data: encodeTestPng(t, 250, 250, true), unknownSize: true, wantErr: errs.ErrFileTooLarge},
+		{name: "truncated image", data: smallPng[:40], wantErr: errs.ErrMalformedFile},
+	}
+	fvs := newTestFileValidatorService()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bucket := test.bucket
+			if bucket == "" {
+				bucket = enums.FILE_BUCKET_MESSAGE_ATTACHMENTS
+			}
+			size := int64(len(test.data))
+			if test.unknownSize {
+				size = -1
+			}
+			validated, err := fvs.Validate(bucket, bytes.NewReader(test.data), size)
+			if test.wantErr != nil {
+				if err != test.wantErr {
+					t.Fatalf("Validate() error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if validated.ContentType != test.wantContentType {
+				t.Errorf("ContentType = %v, want %v", validated.ContentType, test.wantContentType)
+			}
+			if (validated.Data != nil) != test.wantImage {
+				t.Errorf("Data set = %v, want %v", validated.Data != nil, test.wantImage)
+			}
+			content, err := io.ReadAll(validated.File)
+			if err != nil {
+				t.Fatalf("reading validated file: %v", err)
+			}
+			if !test.wantImage && !bytes.Equal(content, test.data) {
+				t.Errorf("validated file differs from the upload")
+			}
+			if test.wantImage && int64(len(content)) != validated.Size {
+				t.Errorf("Size = %v, read %v bytes", validated.Size, len(content))
+			}
+		})
+	}
+}
+
+func TestFileValidatorServiceStreamsOverSizeLimit(t *testing.T) {
+	fvs := newTestFileValidatorService()
+	data := []byte("%PDF-1.4\n" + strings.Repeat("0", testMaxSize))
+	validated, err := fvs.Validate(enums.FILE_BUCKET_MESSAGE_ATTACHMENTS, bytes.NewReader(data), -1)
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if _, err := io.ReadAll(validated.File); err != errs.ErrFileTooLarge {
+		t.Fatalf("reading past the limit error = %v, want %v", err, errs.ErrFileTooLarge)
+	}
+}
+
+// Images declaring too many pixels are rejected from their header, the rest is never read
+func TestFileValidatorServiceRejectsImageFromHeader(t *testing.T) {
+	ihdr := binary.BigEndian.AppendUint32(nil, 100000)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 100000)
+	// 8 bit RGBA, no interlacing
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+	header := []byte("\x89PNG\r\n\x1a\n")
+	header = append(header, pngChunk("IHDR", ihdr)...)
+	// Padding past the sniffed length
+	header = append(header, pngChunk("zzZz", make([]byte, 2*fileSniffLength))...)
+
+	fvs := newTestFileValidatorService()
+	file := io.MultiReader(bytes.NewReader(header), failingReader{})
+	if _, err := fvs.Validate(enums.FILE_BUCKET_MESSAGE_ATTACHMENTS, file, -1); err != errs.ErrImageTooLarge {
+		t.Fatalf("Validate() error = %v, want %v", err, errs.ErrImageTooLarge)
+	}
+}
+
+func TestFileValidatorServiceStripsImages(t *testing.T) {
+	original := encodeTestPng(t, 16, 16, false)
+	// Metadata before the image data and markup after its end
+	withMetadata := bytes.Clone(original[:33])
+	withMetadata = append(withMetadata, pngChunk("tEXt", []byte("Comment\x00<script>alert(1)</script>"))...)
+	withMetadata = append(withMetadata, original[33:]...)
+	withMetadata = append(withMetadata, "<html><script>alert(1)</script></html>"...)
+
+	fvs := newTestFileValidatorService()
+	validated, err := fvs.Validate(enums.FILE_BUCKET_MESSAGE_ATTACHMENTS, bytes.NewReader(withMetadata), int64(len(withMetadata)))
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if !bytes.Equal(validated.Data, original) {
+		t.Errorf("stripped image differs from the original one")
+	}
+}
+
+func TestIsContentTypeAllowed(t *testing.T) {
+	tests := []struct {
+		contentType  string
+		allowedTypes []string
+		want         bool
+	}{
+		{"image/png", []string{"image/png"}, true},
+		{"image/png", []string{"image/*"}, true},
+		{"image/png", []string{"image/jpeg"}, false},
+		{"imagex/png", []string{"image/*"}, false},
+		{"video/mp4", []string{"image/*", "video/*"}, true},
+		{"text/plain", nil, false},
+	}
+	for _, test := range tests {
+		if got := isContentTypeAllowed(test.contentType, test.allowedTypes); got != test.want {
+			t.Errorf("isContentTypeAllowed(%v, %v) = %v, want %v", test.contentType, test.allowedTypes, got, test.want)
+		}
+	}
+}
+
+func TestMaxSizeReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		limit   int64
+		wantErr error
+	}{
+		{"under the limit", 10, 11, nil},
+		{"at the limit", 10, 10, nil},
+		{"over the limit", 11, 10, errs.ErrFileTooLarge},
+		{"empty", 0, 0, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := bytes.Repeat([]byte("a"), test.size)
+			read, err := io.ReadAll(&maxSizeReader{reader: bytes.NewReader(data), remaining: test.limit})
+			if err != test.wantErr {
+				t.Fatalf("error = %v, want %v", err, test.wantErr)
+			}
+			if test.wantErr == nil && len(read) != test.size {
+				t.Errorf("read %v bytes, want %v", len(read), test.size)
+			}
+			if test.wantErr != nil && int64(len(read)) > test.limit {
+				t.Errorf("read %v bytes past the limit of %v", len(read), test.limit)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"socketChat/configs"
+	"socketChat/internal/enums"
+	"socketChat/internal/errs"
+	"socketChat/internal/models"
+	"socketChat/internal/repositories"
+	"strings"
+	"time"
+)
+
+const (
+	defaultGarbageCollectorInterval    = 24 * time.Hour
+	defaultGarbageCollectorGracePeriod = 24 * time.Hour
+	defaultAbandonedAttachmentAge      = 7 * 24 * time.Hour
+	// Abandoned attachments removed per query
+	garbageCollectorBatchSize = 100
+	// Orphaned keys and errors listed per bucket in a report
+	garbageCollectorReportLength = 100
+)
+
+// GarbageCollectorService periodically removes the files nothing refers to anymore: replaced profile photos,
+// attachments never sent, thumbnails of removed attachments and staged uploads never completed.
+// The files of every bucket are reconciled against the references of the database, and the unreferenced
+// ones older than the grace period are deleted. The grace period covers files uploaded but not recorded yet.
+type GarbageCollectorService struct {
+	ctx                    context.Context
+	authRepo               *repositories.AuthenticationRepository
+	attachmentRepo         *repositories.AttachmentRepository
+	uploadRepo             *repositories.UploadRepository
+	storageRepo            *repositories.StorageRepository
+	fileManagerService     *FileManagerService
+	storageService         *StorageService
+	gracePeriod            time.Duration
+	abandonedAttachmentAge time.Duration
+	// Only report what would be removed
+	dryRun bool
+}
+
+func NewGarbageCollectorService(
+	ctx context.Context,
+	authRepo *repositories.AuthenticationRepository,
+	attachmentRepo *repositories.AttachmentRepository,
+	uploadRepo *repositories.UploadRepository,
+	storageRepo *repositories.StorageRepository,
+	fileManagerService *FileManagerService,
+	storageService *StorageService,
+	config *configs.Config,
+) *GarbageCollectorService {
+	interval := time.Duration(config.Viper.GetInt("gc.interval")) * time.Second
+	if interval <= 0 {
+		interval = defaultGarbageCollectorInterval
+	}
+	gracePeriod := time.Duration(config.Viper.GetInt("gc.grace_period")) * time.Second
+	if gracePeriod <= 0 {
+		gracePeriod = defaultGarbageCollectorGracePeriod
+	}
+	abandonedAttachmentAge := time.Duration(config.Viper.GetInt("gc.abandoned_attachment_age")) * time.Second
+	if abandonedAttachmentAge <= 0 {
+		abandonedAttachmentAge = defaultAbandonedAttachmentAge
+	}
+
+	gcs := &GarbageCollectorService{
+		ctx:                    ctx,
+		authRepo:               authRepo,
+		attachmentRepo:         attachmentRepo,
+		uploadRepo:             uploadRepo,
+		storageRepo:            storageRepo,
+		fileManagerService:     fileManagerService,
+		storageService:         storageService,
+		gracePeriod:            gracePeriod,
+		abandonedAttachmentAge: abandonedAttachmentAge,
+		dryRun:                 config.Viper.GetBool("gc.dry_run"),
+	}
+	if config.Viper.GetBool("gc.enabled") {
+		go gcs.collectPeriodically(interval)
+	}
+	return gcs
+}
+
+// Collect removes the abandoned attachments, then the orphaned files of every bucket
+func (gcs *GarbageCollectorService) Collect() *models.GarbageCollectionReport {
+	report := &models.GarbageCollectionReport{
+		DryRun:    gcs.dryRun,
+		StartedAt: time.Now(),
+	}
+	// The files of the removed attachments are orphaned, the reconciliation deletes them
+	report.AbandonedAttachments = gcs.removeAbandonedAttachments(report.StartedAt.Add(-gcs.abandonedAttachmentAge))
+	for _, bucket := range enums.FILE_BUCKETS {
+		report.Buckets = append(report.Buckets, gcs.reconcile(bucket, report.StartedAt.Add(-gcs.gracePeriod)))
+	}
+	report.FinishedAt = time.Now()
+	return report
+}
+
+func (gcs *GarbageCollectorService) collectPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-gcs.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := json.Marshal(gcs.Collect())
+		if err != nil {
+			log.Printf("GarbageCollectorService / collectPeriodically / Error encoding report: %v", err)
+			continue
+		}
+		log.Printf("GarbageCollectorService / collectPeriodically / report: %s", report)
+	}
+}
+
+// removeAbandonedAttachments removes the attachments created before the given time and never sent,
+// releasing their files, and returns how many there were
+func (gcs *GarbageCollectorService) removeAbandonedAttachments(createdBefore time.Time) int {
+	removed := 0
+	var afterID uint
+	for gcs.ctx.Err() == nil {
+		attachments, getErrs := gcs.attachmentRepo.GetAbandonedAttachments(createdBefore, afterID, garbageCollectorBatchSize)
+		if len(getErrs) > 0 {
+			log.Printf("GarbageCollectorService / removeAbandonedAttachments / Error getting abandoned attachments: %v", getErrs)
+			break
+		}
+		for _, attachment := range attachments {
+			afterID = attachment.ID
+			if gcs.dryRun {
+				removed++
+				continue
+			}
+			if deleteErrs := gcs.attachmentRepo.DeleteAbandonedAttachment(attachment.ID); len(deleteErrs) > 0 {
+				// Sent in the meantime
+				if deleteErrs[0] != errs.ErrAttachmentNotFound {
+					log.Printf("GarbageCollectorService / removeAbandonedAttachments / Error deleting attachment %v: %v", attachment.ID, deleteErrs)
+				}
+				continue
+			}
+			removed++
+			// Attachments uploaded before deduplication have no stored object, their files are orphaned as is
+			releaseErrs := gcs.storageService.Release(attachment.UploaderID, attachment.Bucket, attachment.ObjectKey)
+			if len(releaseErrs) > 0 && releaseErrs[0] != errs.ErrFileNotFound {
+				log.Printf("GarbageCollectorService / removeAbandonedAttachments / Error releasing file of attachment %v: %v", attachment.ID, releaseErrs)
+			}
+		}
+		if len(attachments) < garbageCollectorBatchSize {
+			break
+		}
+	}
+	return removed
+}
+
+// reconcile deletes the files of the bucket last modified before the given time that nothing refers to
+func (gcs *GarbageCollectorService) reconcile(bucket string, modifiedBefore time.Time) models.BucketCollectionReport {
+	report := models.BucketCollectionReport{Bucket: bucket}
+	var candidates []*models.FileInfo
+	err := gcs.fileManagerService.List(bucket, func(info *models.FileInfo) error {
+		if info.LastModified.Before(modifiedBefore) {
+			candidates = append(candidates, info)
+		}
+		return gcs.ctx.Err()
+	})
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return report
+	}
+	report.Scanned = len(candidates)
+
+	// References are read after listing, so a file referenced while the bucket was listed is not taken for an orphan.
+	// Nothing is deleted without them.
+	referenced, refErrs := gcs.referencedKeys(bucket)
+	if len(refErrs) > 0 {
+		for _, err := range refErrs {
+			report.Errors = append(report.Errors, err.Error())
+		}
+		return report
+	}
+
+	for _, info := range candidates {
+		if _, ok := referenced[info.Key]; ok {
+			continue
+		}
+		report.Orphaned++
+		report.OrphanedBytes += info.Size
+		if len(report.OrphanedKeys) < garbageCollectorReportLength {
+			report.OrphanedKeys = append(report.OrphanedKeys, info.Key)
+		}
+		if gcs.dryRun {
+			continue
+		}
+		if err := gcs.fileManagerService.Delete(bucket, info.Key); err != nil {
+			if len(report.Errors) < garbageCollectorReportLength {
+				report.Errors = append(report.Errors, err.Error())
+			}
+			continue
+		}
+		report.Deleted++
+	}
+	return report
+}
+
+// referencedKeys returns the keys of the files of the bucket the database refers to
+func (gcs *GarbageCollectorService) referencedKeys(bucket string) (map[string]struct{}, []error) {
+	referenced := make(map[string]struct{})
+	addKeys := func(keys []string, getErrs []error) []error {
+		for _, key := range keys {
+			referenced[key] = struct{}{}
+		}
+		return getErrs
+	}
+
+	if getErrs := addKeys(gcs.storageRepo.GetObjectKeys(bucket)); len(getErrs) > 0 {
+		return nil, getErrs
+	}
+	if getErrs := addKeys(gcs.attachmentRepo.GetObjectKeys(bucket)); len(getErrs) > 0 {
+		return nil, getErrs
+	}
+	switch bucket {
+	case enums.FILE_BUCKET_UPLOAD_CHUNKS:
+		// Staged uploads have no record, they are orphaned once older than the grace period
+		if getErrs := addKeys(gcs.uploadRepo.GetChunkObjectKeys()); len(getErrs) > 0 {
+			return nil, getErrs
+		}
+	case enums.FILE_BUCKET_USER_PROFILE:
+		// Profile photos uploaded before deduplication are only known by their URLs
+		urls, getErrs := gcs.authRepo.GetProfilePhotoUrls()
+		if len(getErrs) > 0 {
+			return nil, getErrs
+		}
+		for _, url := range urls {
+			if _, key, found := strings.Cut(url, "/"+bucket+"/"); found {
+				referenced[key] = struct{}{}
+			}
+		}
+	}
+	return referenced, nil
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"socketChat/configs"
+	"socketChat/internal/enums"
+	"socketChat/internal/errs"
+	"socketChat/internal/models"
+	"socketChat/internal/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLocalFileRoot = "./data/files"
+	// Route the signed URLs of local files are served at
+	LocalFileRoutePrefix = "/files"
+	// Directory under the root holding the content type of every file, outside of the buckets
+	localFileMetadataDir = ".meta"
+	localFileTempPattern = ".upload-*"
+)
+
+// Buckets whose files are served without a signature at the path UploadFile returns, profile photos are shown to everyone
+var LocalPublicFileBuckets = []string{enums.FILE_BUCKET_USER_PROFILE}
+
+// LocalFileManagerService stores files on disk, one directory per bucket, for installs without MinIO.
+// Files are written atomically and read through HMAC signed URLs served by the application.
+type LocalFileManagerService struct {
+	root       string
+	baseUrl    string
+	signingKey []byte
+}
+
+type localFileMetadata struct {
+	ContentType string `json:"content_type"`
+}
+
+func NewLocalFileManagerService(config *configs.Config) *LocalFileManagerService {
+	root := config.Viper.GetString("files.local_root")
+	if root == "" {
+		root = defaultLocalFileRoot
+	}
+	signingKey := config.Viper.GetString("files.signing_key")
+	if signingKey == "" {
+		log.Println("LocalFileManagerService / files.signing_key is not set, signed URLs will not survive a restart")
+		signingKey = utils.GenerateSecretKey()
+	}
+
+	for _, bucketName := range enums.FILE_BUCKETS {
+		for _, dir := range []string{filepath.Join(root, bucketName), filepath.Join(root, localFileMetadataDir, bucketName)} {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				log.Fatalln(err)
+			}
+		}
+	}
+
+	return &LocalFileManagerService{
+		root:       root,
+		baseUrl:    strings.TrimSuffix(config.Viper.GetString("files.public_base_url"), "/"),
+		signingKey: []byte(signingKey),
+	}
+}
+
+func (lfs *LocalFileManagerService) UploadFile(fileName string, file io.Reader, fileSize int64, contentType string, bucketName string) (string, error) {
+	objectPath, metadataPath, err := lfs.paths(bucketName, fileName)
+	if err != nil {
+		return "", err
+	}
+
+	metadata, err := json.Marshal(localFileMetadata{ContentType: contentType})
+	if err != nil {
+		return "", err
+	}
+	// The object is written first so that a failed write leaves no sidecar without its object
+	if err := writeFileAtomically(objectPath, file, fileSize); err != nil {
+		return "", err
+	}
+	if err := writeFileAtomically(metadataPath, strings.NewReader(string(metadata)), -1); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("/%s/%s", bucketName, fileName), nil
+}
+
+func (lfs *LocalFileManagerService) Download(bucketName string, fileName string) (io.ReadCloser, *models.FileInfo, error) {
+	info, err := lfs.Stat(bucketName, fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	objectPath, _, _ := lfs.paths(bucketName, fileName)
+	file, err := os.Open(objectPath)
+	if err != nil {
+		return nil, nil, toLocalFileError(err)
+	}
+	return file, info, nil
+}
+
+func (lfs *LocalFileManagerService) Delete(bucketName string, fileName string) error {
+	objectPath, metadataPath, err := lfs.paths(bucketName, fileName)
+	if err != nil {
+		return err
+	}
+	for _, filePath := range []string{objectPath, metadataPath} {
+		if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (lfs *LocalFileManagerService) Stat(bucketName string, fileName string) (*models.FileInfo, error) {
+	objectPath, metadataPath, err := lfs.paths(bucketName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(objectPath)
+	if err != nil {
+		return nil, toLocalFileError(err)
+	}
+	if stat.IsDir() {
+		return nil, errs.ErrFileNotFound
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(fileName))
+	if data, err := os.ReadFile(metadataPath); err == nil {
+		var metadata localFileMetadata
+		if json.Unmarshal(data, &metadata) == nil && metadata.ContentType != "" {
+			contentType = metadata.ContentType
+		}
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return &models.FileInfo{
+		Key:          fileName,
+		Size:         stat.Size(),
+		ContentType:  contentType,
+		ETag:         fmt.Sprintf("%x-%x", stat.ModTime().UnixNano(), stat.Size()),
+		LastModified: stat.ModTime(),
+	}, nil
+}
+
+// List walks the directory of the bucket. Temporary files of writes in progress are not files of the bucket.
+func (lfs *LocalFileManagerService) List(bucketName string, fn func(info *models.FileInfo) error) error {
+	if !slices.Contains(enums.FILE_BUCKETS, bucketName) {
+		return errs.ErrFileNotFound
+	}
+	bucketPath := filepath.Join(lfs.root, bucketName)
+	err := filepath.WalkDir(bucketPath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == localFileMetadataDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if temp, _ := path.Match(localFileTempPattern, entry.Name()); temp {
+			return nil
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			// Deleted since it was listed
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		fileName, err := filepath.Rel(bucketPath, filePath)
+		if err != nil {
+			return err
+		}
+		return fn(&models.FileInfo{
+			Key:          filepath.ToSlash(fileName),
+			Size:         stat.Size(),
+			ETag:         fmt.Sprintf("%x-%x", stat.ModTime().UnixNano(), stat.Size()),
+			LastModified: stat.ModTime(),
+		})
+	})
+	// Nothing was stored in the bucket yet
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, statErr := os.Stat(bucketPath); errors.Is(statErr, fs.ErrNotExist) {
+			return nil
+		}
+	}
+	return err
+}
+
+func (lfs *LocalFileManagerService) PresignGet(bucketName string, fileName string, expiry time.Duration) (string, error) {
+	return lfs.presign("GET", bucketName, fileName, expiry)
+}
+
+func (lfs *LocalFileManagerService) PresignPut(bucketName string, fileName string, expiry time.Duration) (string, error) {
+	return lfs.presign("PUT", bucketName, fileName, expiry)
+}
+
+// VerifySignature checks a signed URL issued for the method, bucket and file
+func (lfs *LocalFileManagerService) VerifySignature(method string, bucketName string, fileName string, expires string, signature string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return errs.ErrInvalidSignature
+	}
+	expected := lfs.sign(method, bucketName, fileName, expiresAt)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errs.ErrInvalidSignature
+	}
+	if time.Now().Unix() > expiresAt {
+		return errs.ErrSignedUrlExpired
+	}
+	return nil
+}
+
+func (lfs *LocalFileManagerService) presign(method string, bucketName string, fileName string, expiry time.Duration) (string, error) {
+	if _, _, err := lfs.paths(bucketName, fileName); err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(expiry).Unix()
+
+	segments := strings.Split(fileName, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt, 10))
+	query.Set("signature", lfs.sign(method, bucketName, fileName, expiresAt))
+	return fmt.Sprintf("%s%s/%s/%s?%s", lfs.baseUrl, LocalFileRoutePrefix, url.PathEscape(bucketName), strings.Join(segments, "/"), query.Encode()), nil
+}
+
+func (lfs *LocalFileManagerService) sign(method string, bucketName string, fileName string, expiresAt int64) string {
+	mac := hmac.New(sha256.New, lfs.signingKey)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d", method, bucketName, fileName, expiresAt)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// paths returns where the file and its metadata are stored.
+// Unknown buckets and names escaping the bucket are rejected.
+func (lfs *LocalFileManagerService) paths(bucketName string, fileName string) (string, string, error) {
+	if !slices.Contains(enums.FILE_BUCKETS, bucketName) {
+		return "", "", errs.ErrFileNotFound
+	}
+	if fileName == "" || path.Clean("/"+fileName) != "/"+fileName || strings.Contains(fileName, "\\") {
+		return "", "", errs.ErrInvalidObjectKey
+	}
+	objectPath := filepath.Join(lfs.root, bucketName, filepath.FromSlash(fileName))
+	metadataPath := filepath.Join(lfs.root, localFileMetadataDir, bucketName, filepath.FromSlash(fileName)+".json")
+	return objectPath, metadataPath, nil
+}
+
+// writeFileAtomically writes to a temporary file next to the destination and renames it over,
+// readers never see a partially written file
+func writeFileAtomically(filePath string, file io.Reader, fileSize int64) error {
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(dir, localFileTempPattern)
+	if err != nil {
+		return err
+	}
+	// Removing fails harmlessly once the file is renamed
+	defer os.Remove(temp.Name())
+
+	written, err := io.Copy(temp, file)
+	if err == nil && fileSize >= 0 && written != fileSize {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), filePath)
+}
+
+func toLocalFileError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return errs.ErrFileNotFound
+	}
+	return err
+}
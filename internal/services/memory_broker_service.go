@@ -0,0 +1,192 @@
+package services
+
+import (
+	"fmt"
+	"socketChat/internal/models"
+	"socketChat/internal/utils"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMemoryBrokerMaxLen = 10000
+	defaultBrokerChannelTTL   = 24 * time.Hour
+)
+
+// MemoryBrokerService is an in-process broker for single node deployments and tests.
+// Messages are kept in a bounded log per channel and delivered in order by a single dispatcher goroutine.
+// The log of a channel without new messages for channelTTL is dropped.
+type MemoryBrokerService struct {
+	maxLen     int
+	channelTTL time.Duration
+
+	mu sync.Mutex
+	// [channel] => messages, oldest first
+	logs map[string][]*models.BrokerMessage
+	// [channel] => handler
+	handlers   map[string]func(message *models.BrokerMessage)
+	lastMillis int64
+	lastSeq    int64
+	queue      []*models.BrokerMessage
+	// ID of the last message taken off the queue by the dispatcher
+	lastDispatchedId string
+	queueSignal      *sync.Cond
+	closed           bool
+	// Time of the next look for expired channels
+	nextExpiry time.Time
+}
+
+func NewMemoryBrokerService(maxLen int64, channelTTL time.Duration) *MemoryBrokerService {
+	if maxLen <= 0 {
+		maxLen = defaultMemoryBrokerMaxLen
+	}
+	if channelTTL <= 0 {
+		channelTTL = defaultBrokerChannelTTL
+	}
+	mbs := &MemoryBrokerService{
+		maxLen:     int(maxLen),
+		channelTTL: channelTTL,
+		logs:       make(map[string][]*models.BrokerMessage),
+		handlers:   make(map[string]func(message *models.BrokerMessage)),
+	}
+	mbs.queueSignal = sync.NewCond(&mbs.mu)
+	go mbs.dispatch()
+	return mbs
+}
+
+func (mbs *MemoryBrokerService) Publish(channel string, message []byte) (string, error) {
+	mbs.mu.Lock()
+	defer mbs.mu.Unlock()
+
+	brokerMessage := &models.BrokerMessage{
+		ID:      mbs.nextId(),
+		Channel: channel,
+		Payload: message,
+	}
+
+	channelLog := append(mbs.logs[channel], brokerMessage)
+	if len(channelLog) > mbs.maxLen {
+		channelLog = channelLog[len(channelLog)-mbs.maxLen:]
+	}
+	mbs.logs[channel] = channelLog
+	mbs.dropExpiredChannels()
+
+	mbs.queue = append(mbs.queue, brokerMessage)
+	mbs.queueSignal.Signal()
+	return brokerMessage.ID, nil
+}
+
+func (mbs *MemoryBrokerService) Subscribe(channel string, afterId string, handler func(message *models.BrokerMessage)) error {
+	mbs.mu.Lock()
+	defer mbs.mu.Unlock()
+	mbs.handlers[channel] = handler
+	if afterId == "" {
+		return nil
+	}
+	// Messages after afterId that are still queued reach the new handler anyway,
+	// put the ones already dispatched back in front of the queue
+	var backlog []*models.BrokerMessage
+	for _, message := range mbs.logs[channel] {
+		if utils.CompareMessageIds(message.ID, afterId) > 0 && utils.CompareMessageIds(message.ID, mbs.lastDispatchedId) <= 0 {
+			backlog = append(backlog, message)
+		}
+	}
+	if len(backlog) > 0 {
+		mbs.queue = append(backlog, mbs.queue...)
+		mbs.queueSignal.Signal()
+	}
+	return nil
+}
+
+func (mbs *MemoryBrokerService) Unsubscribe(channel string) error {
+	mbs.mu.Lock()
+	defer mbs.mu.Unlock()
+	delete(mbs.handlers, channel)
+	return nil
+}
+
+func (mbs *MemoryBrokerService) Replay(channel string, afterId string, untilId string, limit int64) ([]*models.BrokerMessage, error) {
+	mbs.mu.Lock()
+	defer mbs.mu.Unlock()
+	var messages []*models.BrokerMessage
+	for _, message := range mbs.logs[channel] {
+		if limit > 0 && int64(len(messages)) >= limit {
+			break
+		}
+		if utils.CompareMessageIds(message.ID, afterId) > 0 && utils.CompareMessageIds(message.ID, untilId) <= 0 {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+func (mbs *MemoryBrokerService) LastID(channel string) (string, error) {
+	mbs.mu.Lock()
+	defer mbs.mu.Unlock()
+	channelLog := mbs.logs[channel]
+	if len(channelLog) == 0 {
+		return "0-0", nil
+	}
+	return channelLog[len(channelLog)-1].ID, nil
+}
+
+func (mbs *MemoryBrokerService) Close() error {
+	mbs.mu.Lock()
+	defer mbs.mu.Unlock()
+	mbs.closed = true
+	mbs.queueSignal.Broadcast()
+	return nil
+}
+
+func (mbs *MemoryBrokerService) dispatch() {
+	for {
+		mbs.mu.Lock()
+		for len(mbs.queue) == 0 && !mbs.closed {
+			mbs.queueSignal.Wait()
+		}
+		if mbs.closed {
+			mbs.mu.Unlock()
+			return
+		}
+		message := mbs.queue[0]
+		mbs.queue = mbs.queue[1:]
+		if utils.CompareMessageIds(message.ID, mbs.lastDispatchedId) > 0 {
+			mbs.lastDispatchedId = message.ID
+		}
+		handler, ok := mbs.handlers[message.Channel]
+		mbs.mu.Unlock()
+
+		if ok {
+			handler(message)
+		}
+	}
+}
+
+// dropExpiredChannels drops the logs whose last message is older than channelTTL, like Redis expires their streams.
+// Logs are looked at once per channelTTL at most, it must be called with mbs.mu held.
+func (mbs *MemoryBrokerService) dropExpiredChannels() {
+	now := time.Now()
+	if now.Before(mbs.nextExpiry) {
+		return
+	}
+	mbs.nextExpiry = now.Add(mbs.channelTTL)
+	expiredId := fmt.Sprintf("%d-0", now.Add(-mbs.channelTTL).UnixMilli())
+	for channel, channelLog := range mbs.logs {
+		if utils.CompareMessageIds(channelLog[len(channelLog)-1].ID, expiredId) < 0 {
+			delete(mbs.logs, channel)
+		}
+	}
+}
+
+// nextId returns IDs shaped like Redis stream IDs, <milliseconds>-<sequence>.
+// It must be called with mbs.mu held.
+func (mbs *MemoryBrokerService) nextId() string {
+	millis := time.Now().UnixMilli()
+	if millis <= mbs.lastMillis {
+		mbs.lastSeq++
+	} else {
+		mbs.lastMillis = millis
+		mbs.lastSeq = 0
+	}
+	return fmt.Sprintf("%d-%d", mbs.lastMillis, mbs.lastSeq)
+}
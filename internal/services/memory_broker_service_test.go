@@ -0,0 +1,217 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"socketChat/internal/models"
+	"socketChat/internal/utils"
+	"testing"
+	"time"
+)
+
+func newTestMemoryBroker(t *testing.T, maxLen int64) *MemoryBrokerService {
+	t.Helper()
+	mbs := NewMemoryBrokerService(maxLen, 0)
+	t.Cleanup(func() { mbs.Close() })
+	return mbs
+}
+
+func publishTestMessages(t *testing.T, mbs *MemoryBrokerService, channel string, count int) []string {
+	t.Helper()
+	var ids []string
+	for i := 0; i < count; i++ {
+		id, err := mbs.Publish(channel, []byte(fmt.Sprintf("message %v", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// waitDispatched waits until the dispatcher took every published message off the queue
+func waitDispatched(t *testing.T, mbs *MemoryBrokerService) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		mbs.mu.Lock()
+		queued := len(mbs.queue)
+		mbs.mu.Unlock()
+		if queued == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("messages were not dispatched")
+}
+
+// receive returns a handler and a function waiting for the IDs of the first count messages it got
+func receive(t *testing.T) (func(message *models.BrokerMessage), func(count int) []string) {
+	received := make(chan string, 100)
+	handler := func(message *models.BrokerMessage) {
+		received <- message.ID
+	}
+	wait := func(count int) []string {
+		t.Helper()
+		var ids []string
+		for len(ids) < count {
+			select {
+			case id := <-received:
+				ids = append(ids, id)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("received %v messages, want %v", len(ids), count)
+			}
+		}
+		select {
+		case id := <-received:
+			t.Fatalf("received unexpected message %v", id)
+		case <-time.After(20 * time.Millisecond):
+		}
+		return ids
+	}
+	return handler, wait
+}
+
+func TestMemoryBrokerServicePublishSubscribe(t *testing.T) {
+	mbs := newTestMemoryBroker(t, 0)
+	handler, wait := receive(t)
+	if err := mbs.Subscribe("conversation:1", "", handler); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := publishTestMessages(t, mbs, "conversation:1", 3)
+	publishTestMessages(t, mbs, "conversation:2", 2)
+	if !slices.IsSortedFunc(ids, utils.CompareMessageIds) || ids[0] == ids[1] || ids[1] == ids[2] {
+		t.Errorf("IDs %v are not increasing", ids)
+	}
+	if got := wait(3); !slices.Equal(got, ids) {
+		t.Errorf("received %v, want %v", got, ids)
+	}
+}
+
+func TestMemoryBrokerServiceSubscribeFromId(t *testing.T) {
+	tests := []struct {
+		name    string
+		afterId func(ids []string) string
+		want    func(ids []string) []string
+	}{
+		{"from an id", func(ids []string) string { return ids[1] }, func(ids []string) []string { return ids[2:] }},
+		{"from the start", func(ids []string) string { return "0-0" }, func(ids []string) []string { return ids }},
+		{"from the last id", func(ids []string) string { return ids[len(ids)-1] }, func(ids []string) []string { return nil }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mbs := newTestMemoryBroker(t, 0)
+			// Dispatched without a handler, before anyone subscribed
+			ids := publishTestMessages(t, mbs, "conversation:1", 5)
+			waitDispatched(t, mbs)
+
+			handler, wait := receive(t)
+			if err := mbs.Subscribe("conversation:1", test.afterId(ids), handler); err != nil {
+				t.Fatal(err)
+			}
+			want := test.want(ids)
+			if got := wait(len(want)); !slices.Equal(got, want) {
+				t.Errorf("received %v, want %v", got, want)
+			}
+
+			// Live messages follow the missed ones
+			live := publishTestMessages(t, mbs, "conversation:1", 1)
+			if got := wait(1); !slices.Equal(got, live) {
+				t.Errorf("received %v, want %v", got, live)
+			}
+		})
+	}
+}
+
+func TestMemoryBrokerServiceReplay(t *testing.T) {
+	mbs := newTestMemoryBroker(t, 0)
+	ids := publishTestMessages(t, mbs, "conversation:1", 5)
+	publishTestMessages(t, mbs, "conversation:2", 2)
+
+	tests := []struct {
+		name    string
+		afterId string
+		untilId string
+		limit   int64
+		want    []string
+	}{
+		{"range", ids[0], ids[3], 0, ids[1:4]},
+		{"limited", ids[0], ids[3], 2, ids[1:3]},
+		{"everything", "", ids[4], 0, ids},
+		{"nothing after the last id", ids[4], ids[4], 0, nil},
+		{"until before after", ids[3], ids[1], 0, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			messages, err := mbs.Replay("conversation:1", test.afterId, test.untilId, test.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, message := range messages {
+				if message.Channel != "conversation:1" {
+					t.Errorf("replayed message %v of channel %v", message.ID, message.Channel)
+				}
+				got = append(got, message.ID)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("Replay() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMemoryBrokerServiceLastID(t *testing.T) {
+	mbs := newTestMemoryBroker(t, 0)
+	if id, err := mbs.LastID("conversation:1"); err != nil || id != "0-0" {
+		t.Errorf("LastID() of an empty channel = %v, %v, want 0-0", id, err)
+	}
+	ids := publishTestMessages(t, mbs, "conversation:1", 3)
+	if id, err := mbs.LastID("conversation:1"); err != nil || id != ids[2] {
+		t.Errorf("LastID() = %v, %v, want %v", id, err, ids[2])
+	}
+}
+
+func TestMemoryBrokerServiceTrimsAtMaxLen(t *testing.T) {
+	mbs := newTestMemoryBroker(t, 3)
+	ids := publishTestMessages(t, mbs, "conversation:1", 5)
+	otherIds := publishTestMessages(t, mbs, "conversation:2", 2)
+
+	tests := []struct {
+		channel string
+		want    []string
+	}{
+		{"conversation:1", ids[2:]},
+		// Channels are trimmed on their own
+		{"conversation:2", otherIds},
+	}
+	for _, test := range tests {
+		messages, err := mbs.Replay(test.channel, "", test.want[len(test.want)-1], 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, message := range messages {
+			got = append(got, message.ID)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%v kept %v, want %v", test.channel, got, test.want)
+		}
+	}
+}
+
+func TestMemoryBrokerServiceDropsExpiredChannels(t *testing.T) {
+	mbs := NewMemoryBrokerService(0, 50*time.Millisecond)
+	t.Cleanup(func() { mbs.Close() })
+	publishTestMessages(t, mbs, "conversation:1", 2)
+	time.Sleep(100 * time.Millisecond)
+	ids := publishTestMessages(t, mbs, "conversation:2", 1)
+
+	if id, err := mbs.LastID("conversation:1"); err != nil || id != "0-0" {
+		t.Errorf("LastID() of an expired channel = %v, %v, want 0-0", id, err)
+	}
+	if id, err := mbs.LastID("conversation:2"); err != nil || id != ids[0] {
+		t.Errorf("LastID() = %v, %v, want %v", id, err, ids[0])
+	}
+}
@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/url"
 	"socketChat/configs"
 	"socketChat/internal/enums"
+	"socketChat/internal/errs"
+	"socketChat/internal/models"
 	"sync"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -15,9 +19,13 @@ import (
 
 type MinioService struct {
 	minioClient *minio.Client
-	config      *configs.Config
+	// Signs URLs for the endpoint clients reach MinIO at, it never talks to MinIO itself
+	presignClient *minio.Client
+	config        *configs.Config
 }
 
+const defaultMinioRegion = "us-east-1"
+
 var (
 	minioService *MinioService
 	once         sync.Once
@@ -29,32 +37,53 @@ func NewMinioService(config *configs.Config) *MinioService {
 		accessKeyID := config.Viper.GetString("minio.access_key_id")
 		secretAccessKey := config.Viper.GetString("minio.secret_access_key")
 		useSSL := config.Viper.GetBool("minio.use_ssl")
+		externalEndpoint := config.Viper.GetString("minio.external_endpoint")
+		if externalEndpoint == "" {
+			externalEndpoint = endpoint
+		}
+		// A known region spares the presign client a bucket location lookup
+		region := config.Viper.GetString("minio.region")
+		if region == "" {
+			region = defaultMinioRegion
+		}
 
 		minioClient, err := minio.New(endpoint, &minio.Options{
 			Creds:  credentials.NewStaticV4(accessKeyID, secretAccessKey, ""),
 			Secure: useSSL,
+			Region: region,
 		})
 
 		if err != nil {
 			log.Fatalln(err)
 		}
 
-		bucketName := enums.FILE_BUCKET_USER_PROFILE
-		err = minioClient.MakeBucket(context.Background(), bucketName, minio.MakeBucketOptions{})
+		presignClient, err := minio.New(externalEndpoint, &minio.Options{
+			Creds:  credentials.NewStaticV4(accessKeyID, secretAccessKey, ""),
+			Secure: config.Viper.GetBool("minio.external_use_ssl"),
+			Region: region,
+		})
 		if err != nil {
-			exists, errBucketExists := minioClient.BucketExists(context.Background(), bucketName)
-			if errBucketExists == nil && exists {
-				log.Printf("We already own %s\n", bucketName)
+			log.Fatalln(err)
+		}
+
+		for _, bucketName := range enums.FILE_BUCKETS {
+			err = minioClient.MakeBucket(context.Background(), bucketName, minio.MakeBucketOptions{})
+			if err != nil {
+				exists, errBucketExists := minioClient.BucketExists(context.Background(), bucketName)
+				if errBucketExists == nil && exists {
+					log.Printf("We already own %s\n", bucketName)
+				} else {
+					log.Fatalln(err)
+				}
 			} else {
-				log.Fatalln(err)
+				log.Printf("Successfully created %s\n", bucketName)
 			}
-		} else {
-			log.Printf("Successfully created %s\n", bucketName)
 		}
 
 		minioService = &MinioService{
-			minioClient: minioClient,
-			config:      config,
+			minioClient:   minioClient,
+			presignClient: presignClient,
+			config:        config,
 		}
 	})
 
@@ -79,6 +108,80 @@ func (ms *MinioService) UploadFile(fileName string, file io.Reader, fileSize int
 	return publicUrl, nil
 }
 
+func (ms *MinioService) Download(bucketName string, fileName string) (io.ReadCloser, *models.FileInfo, error) {
+	object, err := ms.minioClient.GetObject(context.Background(), bucketName, fileName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, toFileManagerError(err)
+	}
+	// GetObject is lazy, stat the object to know whether it exists
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, nil, toFileManagerError(err)
+	}
+	return object, toFileInfo(info), nil
+}
+
+func (ms *MinioService) Delete(bucketName string, fileName string) error {
+	return ms.minioClient.RemoveObject(context.Background(), bucketName, fileName, minio.RemoveObjectOptions{})
+}
+
+func (ms *MinioService) Stat(bucketName string, fileName string) (*models.FileInfo, error) {
+	info, err := ms.minioClient.StatObject(context.Background(), bucketName, fileName, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, toFileManagerError(err)
+	}
+	return toFileInfo(info), nil
+}
+
+func (ms *MinioService) PresignGet(bucketName string, fileName string, expiry time.Duration) (string, error) {
+	presignedUrl, err := ms.presignClient.PresignedGetObject(context.Background(), bucketName, fileName, expiry, url.Values{})
+	if err != nil {
+		return "", err
+	}
+	return presignedUrl.String(), nil
+}
+
+func (ms *MinioService) PresignPut(bucketName string, fileName string, expiry time.Duration) (string, error) {
+	presignedUrl, err := ms.presignClient.PresignedPutObject(context.Background(), bucketName, fileName, expiry)
+	if err != nil {
+		return "", err
+	}
+	return presignedUrl.String(), nil
+}
+
+func (ms *MinioService) List(bucketName string, fn func(info *models.FileInfo) error) error {
+	// Cancelling stops the listing goroutine when fn stops early
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for object := range ms.minioClient.ListObjects(ctx, bucketName, minio.ListObjectsOptions{Recursive: true}) {
+		if object.Err != nil {
+			return object.Err
+		}
+		if err := fn(toFileInfo(object)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toFileInfo(info minio.ObjectInfo) *models.FileInfo {
+	return &models.FileInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+	}
+}
+
+func toFileManagerError(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return errs.ErrFileNotFound
+	}
+	return err
+}
+
 func (ms *MinioService) getPublicFileUrl(bucketName, fileKey string) (string, error) {
 	path := fmt.Sprintf("/%s/%s", bucketName, fileKey)
 	return path, nil
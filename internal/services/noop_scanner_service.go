@@ -0,0 +1,21 @@
+package services
+
+import (
+	"io"
+	"socketChat/internal/models"
+)
+
+// NoopScannerService reports every file clean, for deployments without a scanner
+type NoopScannerService struct{}
+
+func NewNoopScannerService() *NoopScannerService {
+	return &NoopScannerService{}
+}
+
+func (ns *NoopScannerService) Scan(file io.Reader) (*models.ScanResult, error) {
+	return &models.ScanResult{}, nil
+}
+
+func (ns *NoopScannerService) MaxFileSize() int64 {
+	return 0
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"socketChat/internal/errs"
+	"socketChat/internal/models"
+	"socketChat/internal/utils"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Field of a stream entry holding the published message
+	redisStreamFieldMessage = "message"
+	redisStreamReadBlock    = time.Second
+)
+
+// RedisBrokerService is a broker backed by Redis Streams, one stream per channel.
+// A single reader goroutine reads every subscribed stream.
+// The stream of a channel without new messages for channelTTL expires.
+type RedisBrokerService struct {
+	redis      *redis.Client
+	ctx        context.Context
+	cancel     context.CancelFunc
+	maxLen     int64
+	channelTTL time.Duration
+
+	mu sync.Mutex
+	// [channel] => subscription
+	subscriptions map[string]*redisSubscription
+	wake          chan struct{}
+	startOnce     sync.Once
+}
+
+type redisSubscription struct {
+	lastId  string
+	handler func(message *models.BrokerMessage)
+}
+
+func NewRedisBrokerService(ctx context.Context, redis *redis.Client, maxLen int64, channelTTL time.Duration) *RedisBrokerService {
+	if channelTTL <= 0 {
+		channelTTL = defaultBrokerChannelTTL
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &RedisBrokerService{
+		redis:         redis,
+		ctx:           ctx,
+		cancel:        cancel,
+		maxLen:        maxLen,
+		channelTTL:    channelTTL,
+		subscriptions: make(map[string]*redisSubscription),
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+func (rbs *RedisBrokerService) Publish(channel string, message []byte) (string, error) {
+	var id *redis.StringCmd
+	_, err := rbs.redis.TxPipelined(rbs.ctx, func(pipe redis.Pipeliner) error {
+		id = pipe.XAdd(rbs.ctx, &redis.XAddArgs{
+			Stream: channel,
+			MaxLen: rbs.maxLen,
+			Approx: true,
+			Values: map[string]any{redisStreamFieldMessage: message},
+		})
+		pipe.Expire(rbs.ctx, channel, rbs.channelTTL)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return id.Val(), nil
+}
+
+func (rbs *RedisBrokerService) Subscribe(channel string, afterId string, handler func(message *models.BrokerMessage)) error {
+	lastId := afterId
+	if lastId == "" {
+		var err error
+		lastId, err = rbs.LastID(channel)
+		if err != nil {
+			return err
+		}
+	}
+
+	rbs.mu.Lock()
+	rbs.subscriptions[channel] = &redisSubscription{
+		lastId:  lastId,
+		handler: handler,
+	}
+	rbs.mu.Unlock()
+
+	rbs.startOnce.Do(func() {
+		go rbs.read()
+	})
+	// Wake the reader up if it is waiting for subscriptions
+	select {
+	case rbs.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (rbs *RedisBrokerService) Unsubscribe(channel string) error {
+	rbs.mu.Lock()
+	defer rbs.mu.Unlock()
+	delete(rbs.subscriptions, channel)
+	return nil
+}
+
+func (rbs *RedisBrokerService) Replay(channel string, afterId string, untilId string, limit int64) ([]*models.BrokerMessage, error) {
+	entries, err := rbs.redis.XRangeN(rbs.ctx, channel, "("+afterId, untilId, limit).Result()
+	if err != nil {
+		return nil, err
+	}
+	var messages []*models.BrokerMessage
+	for _, entry := range entries {
+		message, err := rbs.decode(channel, entry)
+		if err != nil {
+			log.Printf("RedisBrokerService / Replay / skipping entry %v of %v: %v", entry.ID, channel, err)
+			continue
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+func (rbs *RedisBrokerService) LastID(channel string) (string, error) {
+	entries, err := rbs.redis.XRevRangeN(rbs.ctx, channel, "+", "-", 1).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "0-0", nil
+	}
+	return entries[0].ID, nil
+}
+
+func (rbs *RedisBrokerService) Close() error {
+	rbs.cancel()
+	return nil
+}
+
+// read blocks on every subscribed stream at once and hands new entries to the subscription handlers.
+// The subscription set is refreshed after every blocking read.
+func (rbs *RedisBrokerService) read() {
+	for {
+		rbs.mu.Lock()
+		var channels, ids []string
+		for channel, subscription := range rbs.subscriptions {
+			channels = append(channels, channel)
+			ids = append(ids, subscription.lastId)
+		}
+		rbs.mu.Unlock()
+
+		if len(channels) == 0 {
+			select {
+			case <-rbs.wake:
+				continue
+			case <-rbs.ctx.Done():
+				return
+			}
+		}
+
+		streams, err := rbs.redis.XRead(rbs.ctx, &redis.XReadArgs{
+			Streams: append(channels, ids...),
+			Block:   redisStreamReadBlock,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if rbs.ctx.Err() != nil {
+				return
+			}
+			log.Printf("RedisBrokerService / read / Error reading streams: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, entry := range stream.Messages {
+				rbs.mu.Lock()
+				subscription, ok := rbs.subscriptions[stream.Stream]
+				// Skip entries of dropped subscriptions and entries a newer subscription starts after
+				deliver := ok && utils.CompareMessageIds(entry.ID, subscription.lastId) > 0
+				if deliver {
+					subscription.lastId = entry.ID
+				}
+				rbs.mu.Unlock()
+				if !deliver {
+					continue
+				}
+
+				message, err := rbs.decode(stream.Stream, entry)
+				if err != nil {
+					log.Printf("RedisBrokerService / read / skipping entry %v of %v: %v", entry.ID, stream.Stream, err)
+					continue
+				}
+				subscription.handler(message)
+			}
+		}
+	}
+}
+
+func (rbs *RedisBrokerService) decode(channel string, entry redis.XMessage) (*models.BrokerMessage, error) {
+	payload, ok := entry.Values[redisStreamFieldMessage].(string)
+	if !ok {
+		return nil, errs.ErrInvalidBrokerMessage
+	}
+	return &models.BrokerMessage{
+		ID:      entry.ID,
+		Channel: channel,
+		Payload: []byte(payload),
+	}, nil
+}
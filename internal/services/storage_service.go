@@ -0,0 +1,189 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"socketChat/configs"
+	"socketChat/internal/enums"
+	"socketChat/internal/errs"
+	"socketChat/internal/models"
+	"socketChat/internal/repositories"
+	"strings"
+)
+
+// StorageService stores uploads under the SHA-256 of their content, so identical uploads share
+// one file, and charges them to the quotas of their uploaders and conversations
+type StorageService struct {
+	storageRepo        *repositories.StorageRepository
+	fileManagerService *FileManagerService
+	// Bytes a user or a conversation may use, 0 means unlimited
+	userQuota         int64
+	conversationQuota int64
+	// Directory streamed uploads are spooled to while their hash is computed
+	spoolDir string
+}
+
+func NewStorageService(
+	storageRepo *repositories.StorageRepository,
+	fileManagerService *FileManagerService,
+	config *configs.Config,
+) *StorageService {
+	return &StorageService{
+		storageRepo:        storageRepo,
+		fileManagerService: fileManagerService,
+		userQuota:          max(config.Viper.GetInt64("storage.user_quota"), 0),
+		conversationQuota:  max(config.Viper.GetInt64("storage.conversation_quota"), 0),
+		spoolDir:           config.Viper.GetString("storage.spool_dir"),
+	}
+}
+
+// Store charges the file to the owner and stores it, unless a file of the same content
+// is stored in the bucket already. size is -1 if unknown.
+func (ss *StorageService) Store(ownerID uint, bucket string, file io.Reader, size int64, contentType string, extension string) (*models.StoredObject, []error) {
+	var errors []error
+	if err := ss.CheckQuota(ownerID, size); err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+
+	content, hash, size, err := ss.hash(file)
+	if err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	defer content.Close()
+
+	object := &models.StoredObject{
+		Bucket:      bucket,
+		Hash:        hash,
+		ObjectKey:   contentObjectKey(hash, extension),
+		Size:        size,
+		ContentType: contentType,
+	}
+	return ss.storageRepo.AcquireObject(object, ownerID, ss.userQuota, func() (string, error) {
+		return ss.fileManagerService.UploadFile(object.ObjectKey, content, size, contentType, bucket)
+	})
+}
+
+// Release drops a reference of the owner to a stored file, the file is deleted with its last reference
+func (ss *StorageService) Release(ownerID uint, bucket string, objectKey string) []error {
+	return ss.storageRepo.ReleaseObject(ownerID, bucket, objectKey, func() error {
+		return ss.fileManagerService.Delete(bucket, objectKey)
+	})
+}
+
+// ReleaseUrl releases the stored file at the URL. Files stored before deduplication have no stored object
+// and are left alone.
+func (ss *StorageService) ReleaseUrl(ownerID uint, bucket string, url string) []error {
+	if url == "" {
+		return nil
+	}
+	object, getErrs := ss.storageRepo.GetStoredObjectByUrl(bucket, url)
+	if len(getErrs) > 0 {
+		if getErrs[0] == errs.ErrFileNotFound {
+			return nil
+		}
+		return getErrs
+	}
+	return ss.Release(ownerID, bucket, object.ObjectKey)
+}
+
+// CheckQuota tells whether the user has room left for a file of the given size
+func (ss *StorageService) CheckQuota(userID uint, size int64) error {
+	if ss.userQuota <= 0 {
+		return nil
+	}
+	usage, getErrs := ss.storageRepo.GetUsage(enums.STORAGE_OWNER_TYPE_USER, userID)
+	if len(getErrs) > 0 {
+		return getErrs[0]
+	}
+	if usage.UsedBytes+max(size, 0) > ss.userQuota {
+		return errs.ErrStorageQuotaExceeded
+	}
+	return nil
+}
+
+func (ss *StorageService) ConversationQuota() int64 {
+	return ss.conversationQuota
+}
+
+func (ss *StorageService) GetUserUsage(userID uint) (*models.StorageUsageResponse, []error) {
+	return ss.getUsage(enums.STORAGE_OWNER_TYPE_USER, userID, ss.userQuota)
+}
+
+func (ss *StorageService) GetConversationUsage(conversationID uint) (*models.StorageUsageResponse, []error) {
+	return ss.getUsage(enums.STORAGE_OWNER_TYPE_CONVERSATION, conversationID, ss.conversationQuota)
+}
+
+func (ss *StorageService) getUsage(ownerType string, ownerID uint, quota int64) (*models.StorageUsageResponse, []error) {
+	usage, getErrs := ss.storageRepo.GetUsage(ownerType, ownerID)
+	if len(getErrs) > 0 {
+		return nil, getErrs
+	}
+	return &models.StorageUsageResponse{
+		OwnerType:  ownerType,
+		OwnerID:    ownerID,
+		UsedBytes:  usage.UsedBytes,
+		FileCount:  usage.FileCount,
+		QuotaBytes: quota,
+	}, nil
+}
+
+// hash reads the file to compute its SHA-256 and returns it ready to be read again with its size.
+// Files held in memory are rewound, others are spooled to a temporary file removed on close.
+func (ss *StorageService) hash(file io.Reader) (io.ReadSeekCloser, string, int64, error) {
+	hasher := sha256.New()
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		size, err := io.Copy(hasher, seeker)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, "", 0, err
+		}
+		return nopSeekCloser{seeker}, hex.EncodeToString(hasher.Sum(nil)), size, nil
+	}
+
+	spool, err := os.CreateTemp(ss.spoolDir, "storage-spool-*")
+	if err != nil {
+		return nil, "", 0, err
+	}
+	spooled := &spoolFile{File: spool}
+	size, err := io.Copy(io.MultiWriter(spool, hasher), file)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		spooled.Close()
+		return nil, "", 0, err
+	}
+	return spooled, hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+// contentObjectKey spreads the files over prefixes named after the start of their hash
+func contentObjectKey(hash string, extension string) string {
+	return fmt.Sprintf("%s/%s%s", hash[:2], hash, strings.ToLower(extension))
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+// spoolFile is a temporary file removed once closed
+type spoolFile struct {
+	*os.File
+}
+
+func (sf *spoolFile) Close() error {
+	err := sf.File.Close()
+	if removeErr := os.Remove(sf.Name()); removeErr != nil {
+		log.Printf("StorageService / spoolFile.Close / Error removing %v: %v", sf.Name(), removeErr)
+	}
+	return err
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"slices"
+	"socketChat/configs"
+	"socketChat/internal/errs"
+	"socketChat/internal/models"
+	"socketChat/internal/repositories"
+	"socketChat/internal/utils"
+	"strings"
+)
+
+const (
+	defaultThumbnailWorkers             = 2
+	defaultThumbnailQueueSize           = 256
+	defaultThumbnailAvatarSize          = 512
+	defaultThumbnailAvatarThumbnailSize = 96
+)
+
+var defaultThumbnailSizes = []int{128, 512}
+
+// ThumbnailService generates downscaled variants and placeholders of uploaded images.
+// Attachments are processed in the background by a pool of workers, avatars are resized on upload.
+type ThumbnailService struct {
+	ctx                 context.Context
+	attachmentRepo      *repositories.AttachmentRepository
+	fileManagerService  *FileManagerService
+	sizes               []int
+	avatarSize          int
+	avatarThumbnailSize int
+	maxPixels           int
+	jobs                chan *thumbnailJob
+}
+
+// thumbnailJob holds no image data, workers download the file when they get to it
+type thumbnailJob struct {
+	attachmentID uint
+	bucket       string
+	objectKey    string
+}
+
+func NewThumbnailService(
+	ctx context.Context,
+	attachmentRepo *repositories.AttachmentRepository,
+	fileManagerService *FileManagerService,
+	config *configs.Config,
+) *ThumbnailService {
+	var sizes []int
+	for _, size := range config.Viper.GetIntSlice("thumbnail.sizes") {
+		if size > 0 {
+			sizes = append(sizes, size)
+		}
+	}
+	if len(sizes) == 0 {
+		sizes = defaultThumbnailSizes
+	}
+	slices.Sort(sizes)
+	sizes = slices.Compact(sizes)
+
+	workers := config.Viper.GetInt("thumbnail.workers")
+	if workers <= 0 {
+		workers = defaultThumbnailWorkers
+	}
+	queueSize := config.Viper.GetInt("thumbnail.queue_size")
+	if queueSize <= 0 {
+		queueSize = defaultThumbnailQueueSize
+	}
+	avatarSize := config.Viper.GetInt("thumbnail.avatar_size")
+	if avatarSize <= 0 {
+		avatarSize = defaultThumbnailAvatarSize
+	}
+	avatarThumbnailSize := config.Viper.GetInt("thumbnail.avatar_thumbnail_size")
+	if avatarThumbnailSize <= 0 {
+		avatarThumbnailSize = defaultThumbnailAvatarThumbnailSize
+	}
+
+	ts := &ThumbnailService{
+		ctx:                 ctx,
+		attachmentRepo:      attachmentRepo,
+		fileManagerService:  fileManagerService,
+		sizes:               sizes,
+		avatarSize:          avatarSize,
+		avatarThumbnailSize: avatarThumbnailSize,
+		maxPixels:           config.Viper.GetInt("thumbnail.max_pixels"),
+		jobs:                make(chan *thumbnailJob, queueSize),
+	}
+	for i := 0; i < workers; i++ {
+		go ts.work()
+	}
+	return ts
+}
+
+// Enqueue schedules thumbnail generation for an uploaded image attachment without blocking.
+// When the queue is full the attachment is left without variants.
+func (ts *ThumbnailService) Enqueue(attachment *models.MessageAttachment) {
+	job := &thumbnailJob{
+		attachmentID: attachment.ID,
+		bucket:       attachment.Bucket,
+		objectKey:    attachment.ObjectKey,
+	}
+	select {
+	case ts.jobs <- job:
+	default:
+		log.Printf("ThumbnailService / Enqueue / queue is full, skipping attachment %v", attachment.ID)
+	}
+}
+
+func (ts *ThumbnailService) work() {
+	for {
+		select {
+		case <-ts.ctx.Done():
+			return
+		case job := <-ts.jobs:
+			if errors := ts.generateAttachmentThumbnails(job); len(errors) > 0 {
+				log.Printf("ThumbnailService / work / Error generating thumbnails of attachment %v: %v", job.attachmentID, errors)
+			}
+		}
+	}
+}
+
+// generateAttachmentThumbnails stores a variant for every configured size smaller than the image,
+// next to the original object, and records them with the placeholder of the image.
+// Identical uploads share their stored file, the variants of an earlier one are reused.
+func (ts *ThumbnailService) generateAttachmentThumbnails(job *thumbnailJob) []error {
+	var errors []error
+	thumbnailed, getErrs := ts.attachmentRepo.GetThumbnailedAttachment(job.bucket, job.objectKey)
+	if len(getErrs) == 0 {
+		return ts.reuseThumbnails(job, thumbnailed)
+	}
+	if !slices.Contains(getErrs, error(errs.ErrAttachmentNotFound)) {
+		errors = append(errors, getErrs...)
+		return errors
+	}
+
+	file, _, err := ts.fileManagerService.Download(job.bucket, job.objectKey)
+	if err != nil {
+		errors = append(errors, err)
+		return errors
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		errors = append(errors, err)
+		return errors
+	}
+	img, err := utils.DecodeImage(data, ts.maxPixels)
+	if err != nil {
+		errors = append(errors, err)
+		return errors
+	}
+
+	bounds := img.Bounds()
+	longestSide := max(bounds.Dx(), bounds.Dy())
+	baseKey := strings.TrimSuffix(job.objectKey, path.Ext(job.objectKey))
+	var variants []models.AttachmentVariant
+	for _, size := range ts.sizes {
+		if size >= longestSide {
+			break
+		}
+		encoded, err := utils.EncodeImage(utils.ResizeToFit(img, size))
+		if err != nil {
+			errors = append(errors, err)
+			return errors
+		}
+		variant := models.AttachmentVariant{
+			AttachmentID: job.attachmentID,
+			Size:         size,
+			Width:        encoded.Width,
+			Height:       encoded.Height,
+			MimeType:     encoded.ContentType,
+			ObjectKey:    fmt.Sprintf("%s_%d%s", baseKey, size, encoded.Extension),
+		}
+		variant.URL, err = ts.fileManagerService.UploadAttachment(variant.ObjectKey, bytes.NewReader(encoded.Data), int64(len(encoded.Data)), encoded.ContentType, job.bucket)
+		if err != nil {
+			errors = append(errors, err)
+			return errors
+		}
+		variants = append(variants, variant)
+	}
+
+	blurhash, dominantColor, err := utils.ImagePlaceholder(img)
+	if err != nil {
+		errors = append(errors, err)
+		return errors
+	}
+	return ts.attachmentRepo.SaveThumbnails(job.attachmentID, variants, blurhash, dominantColor)
+}
+
+// reuseThumbnails records the variants and the placeholder of an attachment of the same stored file for the job
+func (ts *ThumbnailService) reuseThumbnails(job *thumbnailJob, thumbnailed *models.MessageAttachment) []error {
+	variants := make([]models.AttachmentVariant, 0, len(thumbnailed.Variants))
+	for _, variant := range thumbnailed.Variants {
+		variants = append(variants, models.AttachmentVariant{
+			AttachmentID: job.attachmentID,
+			Size:         variant.Size,
+			Width:        variant.Width,
+			Height:       variant.Height,
+			MimeType:     variant.MimeType,
+			ObjectKey:    variant.ObjectKey,
+			URL:          variant.URL,
+		})
+	}
+	return ts.attachmentRepo.SaveThumbnails(job.attachmentID, variants, *thumbnailed.Blurhash, *thumbnailed.DominantColor)
+}
+
+// ResizeAvatar crops the image to a square and returns it at avatar size, never upscaled,
+// along with a small thumbnail and the blurhash of the avatar
+func (ts *ThumbnailService) ResizeAvatar(file io.Reader) (*models.EncodedImage, *models.EncodedImage, string, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	img, err := utils.DecodeImage(data, ts.maxPixels)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	avatar, err := utils.EncodeImage(utils.ResizeToFill(img, min(side, ts.avatarSize)))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	thumbnailImg := utils.ResizeToFill(img, min(side, ts.avatarThumbnailSize))
+	thumbnail, err := utils.EncodeImage(thumbnailImg)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	blurhash, _, err := utils.ImagePlaceholder(thumbnailImg)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return avatar, thumbnail, blurhash, nil
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"socketChat/configs"
+	"socketChat/internal/enums"
+	"socketChat/internal/errs"
+	"socketChat/internal/models"
+	"socketChat/internal/repositories"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultUploadMaxSize         = 2 << 30
+	defaultUploadMaxChunkSize    = 16 << 20
+	defaultUploadExpiry          = 24 * time.Hour
+	defaultUploadCleanupInterval = 10 * time.Minute
+	// Expired uploads removed per cleanup query
+	uploadCleanupBatchSize = 100
+)
+
+// UploadService runs resumable uploads. Chunks are stored as they arrive and
+// assembled into an attachment when the upload completes, so an interrupted
+// client resumes from the last stored offset on any instance.
+type UploadService struct {
+	ctx                context.Context
+	uploadRepo         *repositories.UploadRepository
+	fileManagerService *FileManagerService
+	attachmentService  *AttachmentService
+	storageService     *StorageService
+	maxSize            int64
+	maxChunkSize       int64
+	expiry             time.Duration
+}
+
+func NewUploadService(
+	ctx context.Context,
+	uploadRepo *repositories.UploadRepository,
+	fileManagerService *FileManagerService,
+	attachmentService *AttachmentService,
+	storageService *StorageService,
+	config *configs.Config,
+) *UploadService {
+	maxSize := config.Viper.GetInt64("uploads.max_size")
+	if maxSize <= 0 {
+		maxSize = defaultUploadMaxSize
+	}
+	maxChunkSize := config.Viper.GetInt64("uploads.max_chunk_size")
+	if maxChunkSize <= 0 {
+		maxChunkSize = defaultUploadMaxChunkSize
+	}
+	expiry := time.Duration(config.Viper.GetInt("uploads.expiry")) * time.Second
+	if expiry <= 0 {
+		expiry = defaultUploadExpiry
+	}
+	cleanupInterval := time.Duration(config.Viper.GetInt("uploads.cleanup_interval")) * time.Second
+	if cleanupInterval <= 0 {
+		cleanupInterval = defaultUploadCleanupInterval
+	}
+
+	us := &UploadService{
+		ctx:                ctx,
+		uploadRepo:         uploadRepo,
+		fileManagerService: fileManagerService,
+		attachmentService:  attachmentService,
+		storageService:     storageService,
+		maxSize:            maxSize,
+		maxChunkSize:       maxChunkSize,
+		expiry:             expiry,
+	}
+	go us.cleanupExpiredUploads(cleanupInterval)
+	return us
+}
+
+func (us *UploadService) CreateUpload(uploaderID uint, request *models.CreateUploadRequest) (*models.Upload, []error) {
+	var errors []error
+	if request.FileName == "" {
+		errors = append(errors, errs.ErrInvalidRequestBody)
+		return nil, errors
+	}
+	if request.Size <= 0 || request.Size > us.maxSize {
+		errors = append(errors, errs.ErrInvalidUploadSize)
+		return nil, errors
+	}
+	// The upload is charged once complete, fail early if it could not fit
+	if err := us.storageService.CheckQuota(uploaderID, request.Size); err != nil {
+		errors = append(errors, err)
+		return nil, errors
+	}
+	contentType := request.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return us.uploadRepo.CreateUpload(&models.Upload{
+		UploaderID: uploaderID,
+		FileName:   filepath.Base(request.FileName),
+		MimeType:   contentType,
+		Size:       request.Size,
+		ExpiresAt:  time.Now().Add(us.expiry),
+	})
+}
+
+func (us *UploadService) GetUpload(uploadID, uploaderID uint) (*models.Upload, []error) {
+	return us.uploadRepo.GetUpload(uploadID, uploaderID)
+}
+
+// WriteChunk stores length bytes of the chunk at offset, which must be the current offset of the upload
+func (us *UploadService) WriteChunk(uploadID, uploaderID uint, offset int64, chunk io.Reader, length int64) (*models.Upload, []error) {
+	var errors []error
+	upload, getErrs := us.uploadRepo.GetUpload(uploadID, uploaderID)
+	if len(getErrs) > 0 {
+		return nil, getErrs
+	}
+	if upload.CompletedAt != nil || offset != upload.Offset {
+		errors = append(errors, errs.ErrUploadOffsetMismatch)
+		return nil, errors
+	}
+	if length <= 0 || length > us.maxChunkSize || offset+length > upload.Size {
+		errors = append(errors, errs.ErrChunkTooLarge)
+		return nil, errors
+	}
+
+	uploadChunk := &models.UploadChunk{
+		UploadID: upload.ID,
+		Offset:   offset,
+		Size:     length,
+		// Chunks racing for the same offset never overwrite each other
+		ObjectKey: fmt.Sprintf("%d/%020d-%s", upload.ID, offset, uuid.NewString()),
+	}
+	if _, err := us.fileManagerService.UploadChunk(uploadChunk.ObjectKey, io.LimitReader(chunk, length), length, enums.FILE_BUCKET_UPLOAD_CHUNKS); err != nil {
+		errors = append(errors, errs.ErrUnableToUploadFile)
+		return nil, errors
+	}
+
+	if appendErrs := us.uploadRepo.AppendChunk(upload, uploadChunk, time.Now().Add(us.expiry)); len(appendErrs) > 0 {
+		us.deleteChunk(uploadChunk.ObjectKey)
+		return nil, appendErrs
+	}
+	return upload, nil
+}
+
+// CompleteUpload assembles the chunks of a fully received upload into an attachment of the uploader
+func (us *UploadService) CompleteUpload(uploadID, uploaderID uint) (*models.MessageAttachment, []error) {
+	upload, getErrs := us.uploadRepo.GetUpload(uploadID, uploaderID)
+	if len(getErrs) > 0 {
+		return nil, getErrs
+	}
+	if claimErrs := us.uploadRepo.ClaimUpload(upload.ID, time.Now().Add(us.expiry)); len(claimErrs) > 0 {
+		return nil, claimErrs
+	}
+
+	chunks, chunkErrs := us.uploadRepo.GetChunks(upload.ID)
+	if len(chunkErrs) > 0 {
+		us.releaseUpload(upload.ID)
+		return nil, chunkErrs
+	}
+	file := &chunkReader{fileManagerService: us.fileManagerService, chunks: chunks}
+	attachment, uploadErrs := us.attachmentService.UploadAttachment(upload.UploaderID, upload.FileName, file, upload.Size)
+	file.Close()
+	if len(uploadErrs) > 0 {
+		us.releaseUpload(upload.ID)
+		return nil, uploadErrs
+	}
+
+	us.removeUpload(upload.ID, chunks)
+	return attachment, nil
+}
+
+// AbortUpload drops the upload and its stored chunks
+func (us *UploadService) AbortUpload(uploadID, uploaderID uint) []error {
+	upload, getErrs := us.uploadRepo.GetUpload(uploadID, uploaderID)
+	if len(getErrs) > 0 {
+		return getErrs
+	}
+	chunks, chunkErrs := us.uploadRepo.GetChunks(upload.ID)
+	if len(chunkErrs) > 0 {
+		return chunkErrs
+	}
+	us.removeUpload(upload.ID, chunks)
+	return nil
+}
+
+func (us *UploadService) cleanupExpiredUploads(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-us.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			uploads, getErrs := us.uploadRepo.GetExpiredUploads(time.Now(), uploadCleanupBatchSize)
+			if len(getErrs) > 0 {
+				log.Printf("UploadService / cleanupExpiredUploads / Error getting expired uploads: %v", getErrs)
+				break
+			}
+			for _, upload := range uploads {
+				chunks, chunkErrs := us.uploadRepo.GetChunks(upload.ID)
+				if len(chunkErrs) > 0 {
+					log.Printf("UploadService / cleanupExpiredUploads / Error getting chunks of upload %v: %v", upload.ID, chunkErrs)
+					continue
+				}
+				us.removeUpload(upload.ID, chunks)
+			}
+			if len(uploads) < uploadCleanupBatchSize {
+				break
+			}
+		}
+	}
+}
+
+func (us *UploadService) removeUpload(uploadID uint, chunks []models.UploadChunk) {
+	for _, chunk := range chunks {
+		us.deleteChunk(chunk.ObjectKey)
+	}
+	if deleteErrs := us.uploadRepo.DeleteUpload(uploadID); len(deleteErrs) > 0 {
+		log.Printf("UploadService / removeUpload / Error deleting upload %v: %v", uploadID, deleteErrs)
+	}
+}
+
+func (us *UploadService) deleteChunk(objectKey string) {
+	if err := us.fileManagerService.Delete(enums.FILE_BUCKET_UPLOAD_CHUNKS, objectKey); err != nil {
+		log.Printf("UploadService / deleteChunk / Error deleting chunk %v: %v", objectKey, err)
+	}
+}
+
+func (us *UploadService) releaseUpload(uploadID uint) {
+	if releaseErrs := us.uploadRepo.ReleaseUpload(uploadID); len(releaseErrs) > 0 {
+		log.Printf("UploadService / releaseUpload / Error releasing upload %v: %v", uploadID, releaseErrs)
+	}
+}
+
+// chunkReader reads the stored chunks of an upload one after another,
+// downloading each only once the previous one is consumed
+type chunkReader struct {
+	fileManagerService *FileManagerService
+	chunks             []models.UploadChunk
+	current            io.ReadCloser
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if cr.current == nil {
+			if len(cr.chunks) == 0 {
+				return 0, io.EOF
+			}
+			file, _, err := cr.fileManagerService.Download(enums.FILE_BUCKET_UPLOAD_CHUNKS, cr.chunks[0].ObjectKey)
+			if err != nil {
+				return 0, err
+			}
+			cr.current = file
+			cr.chunks = cr.chunks[1:]
+		}
+
+		n, err := cr.current.Read(p)
+		if err == io.EOF {
+			cr.current.Close()
+			cr.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (cr *chunkReader) Close() error {
+	if cr.current == nil {
+		return nil
+	}
+	err := cr.current.Close()
+	cr.current = nil
+	return err
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"socketChat/configs"
+	"socketChat/internal/enums"
+	"socketChat/internal/errs"
+	"socketChat/internal/models"
+	"testing"
+	"testing/iotest"
+
+	"github.com/spf13/viper"
+)
+
+func newTestLocalFileManagerService(t *testing.T) *FileManagerService {
+	t.Helper()
+	v := viper.New()
+	v.Set("files.local_root", t.TempDir())
+	v.Set("files.signing_key", "test")
+	return NewFileManagerService(NewLocalFileManagerService(&configs.Config{Viper: v}))
+}
+
+func TestChunkReader(t *testing.T) {
+	fileManagerService := newTestLocalFileManagerService(t)
+	contents := map[string][]byte{
+		"1/0":      []byte("hello "),
+		"1/6":      {},
+		"1/6-next": []byte("chunked "),
+		"1/14":     bytes.Repeat([]byte("world"), 10000),
+	}
+	for key, content := range contents {
+		if _, err := fileManagerService.UploadChunk(key, bytes.NewReader(content), int64(len(content)), enums.FILE_BUCKET_UPLOAD_CHUNKS); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		keys    []string
+		wantErr error
+	}{
+		{name: "no chunks"},
+		{name: "one chunk", keys: []string{"1/0"}},
+		{name: "chunks in order", keys: []string{"1/0", "1/6-next", "1/14"}},
+		{name: "empty chunk", keys: []string{"1/0", "1/6", "1/6-next"}},
+		{name: "missing chunk", keys: []string{"1/0", "1/missing", "1/14"}, wantErr: errs.ErrFileNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var chunks []models.UploadChunk
+			var want []byte
+			for _, key := range test.keys {
+				chunks = append(chunks, models.UploadChunk{ObjectKey: key})
+				want = append(want, contents[key]...)
+			}
+			reader := &chunkReader{fileManagerService: fileManagerService, chunks: chunks}
+			defer reader.Close()
+
+			// Reading a byte at a time ends reads inside and at the end of chunks
+			got, err := io.ReadAll(iotest.OneByteReader(reader))
+			if test.wantErr != nil {
+				if err != test.wantErr {
+					t.Fatalf("reading chunks error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("reading chunks error = %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("read %v bytes, want %v", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestChunkReaderClose(t *testing.T) {
+	fileManagerService := newTestLocalFileManagerService(t)
+	if _, err := fileManagerService.UploadChunk("1/0", bytes.NewReader([]byte("hello")), 5, enums.FILE_BUCKET_UPLOAD_CHUNKS); err != nil {
+		t.Fatal(err)
+	}
+	reader := &chunkReader{fileManagerService: fileManagerService, chunks: []models.UploadChunk{{ObjectKey: "1/0"}}}
+	if _, err := reader.Read(make([]byte, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if reader.current != nil {
+		t.Errorf("Close() kept the current chunk open")
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatalf("second Close() error = %v", err)
+	}
+}
@@ -38,3 +38,7 @@ func (ws *WhiteboardService) CreareNewDrawn(drawn *models.Drawn) (*models.Drawn,
 func (ws *WhiteboardService) CreateSubDrawn(subDrownPayload *models.WhiteboardSocketPayload) (*models.SubDrawn, error) {
 	return ws.whiteboardRepo.CreateSubDrawn(subDrownPayload)
 }
+
+func (ws *WhiteboardService) CheckUserInWhiteboard(userID, whiteboardID uint) bool {
+	return ws.whiteboardRepo.CheckUserInWhiteboard(userID, whiteboardID)
+}
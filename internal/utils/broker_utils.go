@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareMessageIds compares two <milliseconds>-<sequence> broker message IDs like strings.Compare does.
+// An empty ID is the smallest one.
+func CompareMessageIds(a, b string) int {
+	aMillis, aSeq := parseMessageId(a)
+	bMillis, bSeq := parseMessageId(b)
+	switch {
+	case aMillis != bMillis:
+		if aMillis < bMillis {
+			return -1
+		}
+		return 1
+	case aSeq != bSeq:
+		if aSeq < bSeq {
+			return -1
+		}
+		return 1
+	default:
+		return 0
+	}
+}
+
+func parseMessageId(id string) (int64, int64) {
+	millisStr, seqStr, _ := strings.Cut(id, "-")
+	millis, _ := strconv.ParseInt(millisStr, 10, 64)
+	seq, _ := strconv.ParseInt(seqStr, 10, 64)
+	return millis, seq
+}
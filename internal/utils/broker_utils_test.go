@@ -0,0 +1,27 @@
+package utils
+
+import "testing"
+
+func TestCompareMessageIds(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1700000000000-0", "1700000000000-0", 0},
+		{"1700000000000-0", "1700000000001-0", -1},
+		{"1700000000001-0", "1700000000000-5", 1},
+		{"1700000000000-1", "1700000000000-0", 1},
+		// Parts are compared as numbers, not as strings
+		{"1700000000000-9", "1700000000000-10", -1},
+		{"999-0", "1000-0", -1},
+		{"", "0-1", -1},
+		{"0-1", "", 1},
+		{"", "", 0},
+		{"", "0-0", 0},
+	}
+	for _, test := range tests {
+		if got := CompareMessageIds(test.a, test.b); got != test.want {
+			t.Errorf("CompareMessageIds(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"socketChat/internal/errs"
+)
+
+const (
+	// Quality of JPEG images that have to be re-encoded to apply their EXIF orientation
+	orientedJpegQuality = 92
+	exifOrientationTag  = 0x0112
+)
+
+// StripImageMetadata removes EXIF, XMP, IPTC and text metadata from JPEG, PNG and WebP images,
+// along with anything appended after the end of the image. Pixels are kept as they are,
+// except for JPEG images with an EXIF orientation, which are rotated upright and re-encoded.
+// Other content types are returned unchanged.
+func StripImageMetadata(data []byte, contentType string) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		stripped, orientation, err := stripJpegMetadata(data)
+		if err != nil || orientation <= 1 {
+			return stripped, err
+		}
+		img, err := jpeg.Decode(bytes.NewReader(stripped))
+		if err != nil {
+			return nil, errs.ErrMalformedFile
+		}
+		var buffer bytes.Buffer
+		if err := jpeg.Encode(&buffer, ApplyOrientation(img, orientation), &jpeg.Options{Quality: orientedJpegQuality}); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	case "image/png":
+		return stripPngMetadata(data)
+	case "image/webp":
+		return stripWebpMetadata(data)
+	default:
+		return data, nil
+	}
+}
+
+// stripJpegMetadata keeps the JFIF, ICC profile and Adobe segments and drops the other application
+// segments and comments. It returns the EXIF orientation found in the dropped segments, 1 if there is none.
+func stripJpegMetadata(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, errs.ErrMalformedFile
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	orientation := 1
+
+	pos := 2
+	for {
+		if pos+4 > len(data) || data[pos] != 0xFF {
+			return nil, 0, errs.ErrMalformedFile
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// Fill byte
+			pos++
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, 0, errs.ErrMalformedFile
+		}
+		segment := data[pos:end]
+		payload := segment[4:]
+
+		if marker == 0xDA {
+			// Start of scan, entropy coded data stuffs every 0xFF with 0x00 so the first
+			// end of image marker after it closes the image, anything after it is dropped
+			eoi := bytes.Index(data[end:], []byte{0xFF, 0xD9})
+			if eoi < 0 {
+				return nil, 0, errs.ErrMalformedFile
+			}
+			out.Write(data[pos : end+eoi+2])
+			return out.Bytes(), orientation, nil
+		}
+
+		keep := true
+		switch {
+		case marker == 0xE1:
+			if bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+				orientation = exifOrientation(payload[6:])
+			}
+			keep = false
+		case marker == 0xE2:
+			keep = bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+		case marker > 0xE0 && marker <= 0xEF && marker != 0xEE:
+			keep = false
+		case marker == 0xFE:
+			keep = false
+		}
+		if keep {
+			out.Write(segment)
+		}
+		pos = end
+	}
+}
+
+// exifOrientation reads the orientation tag of the first IFD of a TIFF structure, 1 if it is missing
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == exifOrientationTag {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// ApplyOrientation transforms the image as described by an EXIF orientation so that it displays upright
+func ApplyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = width-1-x, y
+			case 3:
+				dx, dy = width-1-x, height-1-y
+			case 4:
+				dx, dy = x, height-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = height-1-y, x
+			case 7:
+				dx, dy = height-1-y, width-1-x
+			case 8:
+				dx, dy = y, width-1-x
+			}
+			dst.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// stripPngMetadata drops the text, EXIF and time chunks and anything after the end chunk
+func stripPngMetadata(data []byte) ([]byte, error) {
+	signature := []byte("\x89PNG\r\n\x1a\n")
+	if !bytes.HasPrefix(data, signature) {
+		return nil, errs.ErrMalformedFile
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(signature)
+
+	pos := len(signature)
+	for {
+		if pos+8 > len(data) {
+			return nil, errs.ErrMalformedFile
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		chunkType := string(data[pos+4 : pos+8])
+		// Length, type, data and CRC
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, errs.ErrMalformedFile
+		}
+		switch chunkType {
+		case "tEXt", "zTXt", "iTXt", "eXIf", "tIME":
+		default:
+			out.Write(data[pos:end])
+		}
+		if chunkType == "IEND" {
+			return out.Bytes(), nil
+		}
+		pos = end
+	}
+}
+
+// stripWebpMetadata drops the EXIF and XMP chunks, clears their flags and drops anything after the RIFF container
+func stripWebpMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errs.ErrMalformedFile
+	}
+	riffEnd := 8 + int(binary.LittleEndian.Uint32(data[4:]))
+	if riffEnd > len(data) {
+		return nil, errs.ErrMalformedFile
+	}
+	out := bytes.NewBuffer(make([]byte, 0, riffEnd))
+	out.Write(data[:12])
+
+	pos := 12
+	for pos < riffEnd {
+		if pos+8 > riffEnd {
+			return nil, errs.ErrMalformedFile
+		}
+		fourCC := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		// Chunks are padded to an even size
+		end := pos + 8 + size + size%2
+		if size < 0 || end > riffEnd {
+			return nil, errs.ErrMalformedFile
+		}
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := bytes.Clone(data[pos:end])
+			if len(chunk) > 8 {
+				// Clear the EXIF and XMP flags
+				chunk[8] &^= 0x08 | 0x04
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	stripped := out.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:], uint32(len(stripped)-8))
+	return stripped, nil
+}
@@ -0,0 +1,282 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"socketChat/internal/errs"
+	"testing"
+)
+
+func testExif(order binary.AppendByteOrder, orientation uint16) []byte {
+	tiff := []byte("II")
+	if order == binary.BigEndian {
+		tiff = []byte("MM")
+	}
+	tiff = order.AppendUint16(tiff, 42)
+	tiff = order.AppendUint32(tiff, 8)
+	// One IFD entry: tag, SHORT type, count 1, value
+	tiff = order.AppendUint16(tiff, 1)
+	tiff = order.AppendUint16(tiff, exifOrientationTag)
+	tiff = order.AppendUint16(tiff, 3)
+	tiff = order.AppendUint32(tiff, 1)
+	tiff = order.AppendUint16(tiff, orientation)
+	tiff = order.AppendUint16(tiff, 0)
+	return order.AppendUint32(tiff, 0)
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func webpChunk(fourCC string, data []byte) []byte {
+	chunk := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func webpContainer(chunks ...[]byte) []byte {
+	body := []byte("WEBP")
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+func testImage(width, height int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(y*width + x)})
+		}
+	}
+	return img
+}
+
+func encodeTestJpeg(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, testImage(width, height), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// withJpegSegments inserts segments right after the start of image marker
+func withJpegSegments(data []byte, segments ...[]byte) []byte {
+	out := bytes.Clone(data[:2])
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, data[2:]...)
+}
+
+func TestStripImageMetadata(t *testing.T) {
+	plainJpeg := encodeTestJpeg(t, 8, 4)
+	icc := jpegSegment(0xE2, []byte("ICC_PROFILE\x00\x01\x01profile"))
+
+	var pngBuffer bytes.Buffer
+	if err := png.Encode(&pngBuffer, testImage(8, 4)); err != nil {
+		t.Fatal(err)
+	}
+	plainPng := pngBuffer.Bytes()
+	// The signature and IHDR chunk
+	pngHeader := plainPng[:33]
+
+	vp8x := []byte{0x08 | 0x04 | 0x10, 0, 0, 0, 7, 0, 0, 3, 0, 0}
+	strippedVp8x := []byte{0x10, 0, 0, 0, 7, 0, 0, 3, 0, 0}
+	vp8l := webpChunk("VP8L", []byte("pixels"))
+
+	tests := []struct {
+		name        string
+		contentType string
+		data        []byte
+		want        []byte
+		wantErr     error
+	}{
+		{
+			name:        "jpeg without metadata",
+			contentType: "image/jpeg",
+			data:        plainJpeg,
+			want:        plainJpeg,
+		},
+		{
+			name:        "jpeg metadata and trailing data",
+			contentType: "image/jpeg",
+			data: append(withJpegSegments(plainJpeg,
+				jpegSegment(0xE1, append([]byte("Exif\x00\x00"), testExif(binary.LittleEndian, 1)...)),
+				jpegSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>")),
+				jpegSegment(0xED, []byte("Photoshop 3.0\x00")),
+				jpegSegment(0xFE, []byte("<script>alert(1)</script>")),
+			), "<html></html>"...),
+			want: plainJpeg,
+		},
+		{
+			name:        "jpeg icc profile kept",
+			contentType: "image/jpeg",
+			data:        withJpegSegments(plainJpeg, icc, jpegSegment(0xFE, []byte("comment"))),
+			want:        withJpegSegments(plainJpeg, icc),
+		},
+		{
+			name:        "jpeg without start of image",
+			contentType: "image/jpeg",
+			data:        plainJpeg[2:],
+			wantErr:     errs.ErrMalformedFile,
+		},
+		{
+			name:        "jpeg without end of image",
+			contentType: "image/jpeg",
+			data:        plainJpeg[:len(plainJpeg)-2],
+			wantErr:     errs.ErrMalformedFile,
+		},
+		{
+			name:        "png metadata and trailing data",
+			contentType: "image/png",
+			data: append(append(append(bytes.Clone(pngHeader),
+				append(pngChunk("tEXt", []byte("Comment\x00<script>alert(1)</script>")),
+					append(pngChunk("eXIf", testExif(binary.BigEndian, 6)), pngChunk("tIME", make([]byte, 7))...)...)...),
+				plainPng[33:]...), "<html></html>"...),
+			want: plainPng,
+		},
+		{
+			name:        "png without end chunk",
+			contentType: "image/png",
+			data:        plainPng[:len(plainPng)-12],
+			wantErr:     errs.ErrMalformedFile,
+		},
+		{
+			name:        "png without signature",
+			contentType: "image/png",
+			data:        plainPng[8:],
+			wantErr:     errs.ErrMalformedFile,
+		},
+		{
+			name:        "webp metadata and trailing data",
+			contentType: "image/webp",
+			data: append(webpContainer(
+				webpChunk("VP8X", vp8x),
+				webpChunk("EXIF", testExif(binary.LittleEndian, 3)),
+				vp8l,
+				webpChunk("XMP ", []byte("<x:xmpmeta/>")),
+			), "<html></html>"...),
+			want: webpContainer(webpChunk("VP8X", strippedVp8x), vp8l),
+		},
+		{
+			name:        "webp larger than its data",
+			contentType: "image/webp",
+			data:        webpContainer(vp8l)[:16],
+			wantErr:     errs.ErrMalformedFile,
+		},
+		{
+			name:        "other content type",
+			contentType: "application/pdf",
+			data:        []byte("%PDF-1.4"),
+			want:        []byte("%PDF-1.4"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := StripImageMetadata(test.data, test.contentType)
+			if err != test.wantErr {
+				t.Fatalf("StripImageMetadata() error = %v, want %v", err, test.wantErr)
+			}
+			if !bytes.Equal(got, test.want) {
+				t.Errorf("StripImageMetadata() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStripImageMetadataOrientsJpeg(t *testing.T) {
+	exif := jpegSegment(0xE1, append([]byte("Exif\x00\x00"), testExif(binary.BigEndian, 6)...))
+	data := withJpegSegments(encodeTestJpeg(t, 8, 4), exif)
+
+	stripped, err := StripImageMetadata(data, "image/jpeg")
+	if err != nil {
+		t.Fatalf("StripImageMetadata() error = %v", err)
+	}
+	if bytes.Contains(stripped, []byte("Exif")) {
+		t.Errorf("EXIF segment kept")
+	}
+	config, err := jpeg.DecodeConfig(bytes.NewReader(stripped))
+	if err != nil {
+		t.Fatalf("decoding stripped image: %v", err)
+	}
+	if config.Width != 4 || config.Height != 8 {
+		t.Errorf("stripped image is %vx%v, want 4x8", config.Width, config.Height)
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	truncated := testExif(binary.LittleEndian, 6)
+	tests := []struct {
+		name string
+		tiff []byte
+		want int
+	}{
+		{"little endian", testExif(binary.LittleEndian, 6), 6},
+		{"big endian", testExif(binary.BigEndian, 8), 8},
+		{"out of range", testExif(binary.LittleEndian, 9), 1},
+		{"unknown byte order", append([]byte("XX"), truncated[2:]...), 1},
+		{"truncated entry", truncated[:14], 1},
+		{"too short", []byte("II"), 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := exifOrientation(test.tiff); got != test.want {
+				t.Errorf("exifOrientation() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// The source image is 3x2:
+	//   0 1 2
+	//   3 4 5
+	tests := []struct {
+		orientation int
+		want        [][]uint8
+	}{
+		{1, [][]uint8{{0, 1, 2}, {3, 4, 5}}},
+		{2, [][]uint8{{2, 1, 0}, {5, 4, 3}}},
+		{3, [][]uint8{{5, 4, 3}, {2, 1, 0}}},
+		{4, [][]uint8{{3, 4, 5}, {0, 1, 2}}},
+		{5, [][]uint8{{0, 3}, {1, 4}, {2, 5}}},
+		{6, [][]uint8{{3, 0}, {4, 1}, {5, 2}}},
+		{7, [][]uint8{{5, 2}, {4, 1}, {3, 0}}},
+		{8, [][]uint8{{2, 5}, {1, 4}, {0, 3}}},
+	}
+	for _, test := range tests {
+		oriented := ApplyOrientation(testImage(3, 2), test.orientation)
+		bounds := oriented.Bounds()
+		if bounds.Dx() != len(test.want[0]) || bounds.Dy() != len(test.want) {
+			t.Errorf("orientation %v: image is %vx%v, want %vx%v", test.orientation, bounds.Dx(), bounds.Dy(), len(test.want[0]), len(test.want))
+			continue
+		}
+		for y, row := range test.want {
+			for x, want := range row {
+				got := color.GrayModel.Convert(oriented.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y
+				if got != want {
+					t.Errorf("orientation %v: pixel (%v, %v) = %v, want %v", test.orientation, x, y, got, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"socketChat/internal/errs"
+	"socketChat/internal/models"
+
+	"github.com/buckket/go-blurhash"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	imageJpegQuality = 85
+	// Images are shrunk to this size before placeholders are computed from them
+	imagePlaceholderSize = 32
+	blurhashXComponents  = 4
+	blurhashYComponents  = 3
+)
+
+// DecodeImage decodes a JPEG, PNG, GIF or WebP image, animated GIFs decode to their first frame.
+// Images with more than maxPixels pixels are rejected before they are decoded, 0 means no limit.
+func DecodeImage(data []byte, maxPixels int) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errs.ErrInvalidImage
+	}
+	if maxPixels > 0 && config.Width*config.Height > maxPixels {
+		return nil, errs.ErrImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errs.ErrInvalidImage
+	}
+	return img, nil
+}
+
+// ResizeToFit scales the image down so that its longest side is size, keeping the aspect ratio
+func ResizeToFit(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width >= height {
+		height = max(1, height*size/width)
+		width = size
+	} else {
+		width = max(1, width*size/height)
+		height = size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// ResizeToFill crops the centre square of the image and scales it to size x size
+func ResizeToFill(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, image.Rect(x, y, x+side, y+side), draw.Src, nil)
+	return dst
+}
+
+// EncodeImage encodes opaque images as JPEG and the ones with transparency as PNG
+func EncodeImage(img image.Image) (*models.EncodedImage, error) {
+	encoded := &models.EncodedImage{
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+	}
+	var buffer bytes.Buffer
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: imageJpegQuality}); err != nil {
+			return nil, err
+		}
+		encoded.ContentType = "image/jpeg"
+		encoded.Extension = ".jpg"
+	} else {
+		if err := png.Encode(&buffer, img); err != nil {
+			return nil, err
+		}
+		encoded.ContentType = "image/png"
+		encoded.Extension = ".png"
+	}
+	encoded.Data = buffer.Bytes()
+	return encoded, nil
+}
+
+// ImagePlaceholder computes the blurhash and the dominant color, as #rrggbb, clients show while the image loads
+func ImagePlaceholder(img image.Image) (string, string, error) {
+	small := img
+	bounds := img.Bounds()
+	if max(bounds.Dx(), bounds.Dy()) > imagePlaceholderSize {
+		small = ResizeToFit(img, imagePlaceholderSize)
+	}
+	hash, err := blurhash.Encode(blurhashXComponents, blurhashYComponents, small)
+	if err != nil {
+		return "", "", err
+	}
+	return hash, dominantColor(small), nil
+}
+
+// dominantColor averages the visible pixels of the image, transparent ones don't count
+func dominantColor(img image.Image) string {
+	var r, g, b, weight uint64
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			r += uint64(pixel.R) * uint64(pixel.A)
+			g += uint64(pixel.G) * uint64(pixel.A)
+			b += uint64(pixel.B) * uint64(pixel.A)
+			weight += uint64(pixel.A)
+		}
+	}
+	if weight == 0 {
+		return "#000000"
+	}
+	return fmt.Sprintf("#%02x%02x%02x", r/weight, g/weight, b/weight)
+}